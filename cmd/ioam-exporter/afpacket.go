@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/Advanced-Observability/ioam-exporter/source/afpacket"
+)
+
+// Captures the IOAM packets of the given interfaces, every interface if
+// none, and feeds their traces to the pipeline until SIGINT/SIGTERM
+func capturePackets(interfaces []string) {
+	if len(interfaces) == 0 {
+		interfaces = []string{""}
+	}
+	var sockets []*afpacket.Socket
+	for _, ifName := range interfaces {
+		s, err := afpacket.Open(ifName)
+		if err != nil {
+			log.Fatalf("failed to capture on %q: %v", ifName, err)
+		}
+		sockets = append(sockets, s)
+	}
+
+	p, stop := startPipeline()
+	defer stop()
+
+	var stopping atomic.Bool
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		stopping.Store(true)
+		for _, s := range sockets {
+			s.Close()
+		}
+	}()
+
+	var packets, traces atomic.Uint64
+	var wg sync.WaitGroup
+	for _, s := range sockets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, afpacket.AFPACKET_BUFFER_LEN)
+			for {
+				n, err := s.Read(buf)
+				if err != nil {
+					if !stopping.Load() {
+						log.Printf("%s: %v", s.Name(), err)
+					}
+					return
+				}
+				packets.Add(1)
+
+				// The buffer is reused, traces must not refer to it
+				count, err := submitPacketTraces(p, ioam.LINKTYPE_RAW, append([]byte(nil), buf[:n]...), time.Now(), s.Name())
+				traces.Add(count)
+				if err != nil && !errors.Is(err, ioam.ErrNotIPv6) {
+					log.Printf("%s: %v", s.Name(), err)
+				}
+			}
+		}()
+	}
+	log.Printf("[IOAM Exporter] Capturing IOAM packets on %d interface(s)...", len(sockets))
+
+	wg.Wait()
+	log.Printf("[IOAM Exporter] Stopping... captured %d packets with %d IOAM options", packets.Load(), traces.Load())
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/Advanced-Observability/ioam-exporter/ipfix"
+)
+
+// Counters of the built-in collector
+type ipfixCollectorStats struct {
+	messages       atomic.Uint64 // decoded IPFIX messages
+	records        atomic.Uint64 // decoded data records
+	decodeErrors   atomic.Uint64 // messages which could not be decoded
+	sequenceErrors atomic.Uint64 // messages whose sequence number was not the expected one
+}
+
+// Built-in IPFIX collector, decoding the messages of the exporter and
+// printing the traces as the console output does
+type ipfixCollector struct {
+	mu    sync.Mutex // serialises output
+	out   io.Writer
+	stats ipfixCollectorStats
+}
+
+// State of a transport session: templates and expected sequence numbers per
+// observation domain (RFC 7011 section 10.3.2 for UDP sessions)
+type collectorSession struct {
+	name      string
+	decoder   *ipfix.Decoder
+	sequences map[uint32]uint32
+}
+
+func newIPFIXCollector(out io.Writer) *ipfixCollector {
+	return &ipfixCollector{out: out}
+}
+
+func newCollectorSession(name string) *collectorSession {
+	return &collectorSession{name: name, decoder: ipfix.NewDecoder(), sequences: make(map[uint32]uint32)}
+}
+
+// Runs the built-in collector on UDP and TCP until one of the listeners fails
+func runCollector(addr string, out io.Writer) error {
+	udp, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer udp.Close()
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer tcp.Close()
+
+	log.Printf("[IOAM Exporter] Collecting on %s (UDP and TCP)...", addr)
+	c := newIPFIXCollector(out)
+	errs := make(chan error, 2)
+	go func() { errs <- c.serveUDP(udp) }()
+	go func() { errs <- c.serveTCP(tcp) }()
+
+	return <-errs
+}
+
+// Receives IPFIX messages over UDP, every exporter address being a session
+func (c *ipfixCollector) serveUDP(conn net.PacketConn) error {
+	sessions := make(map[string]*collectorSession)
+	buf := make([]byte, ipfix.IPFIX_MAX_MESSAGE_LEN)
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		s, ok := sessions[addr.String()]
+		if !ok {
+			s = newCollectorSession("udp://" + addr.String())
+			sessions[addr.String()] = s
+		}
+		c.handle(s, buf[:n])
+	}
+}
+
+// Accepts TCP connections, every connection being a session
+func (c *ipfixCollector) serveTCP(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go c.serveStream(conn, newCollectorSession("tcp://"+conn.RemoteAddr().String()))
+	}
+}
+
+// Reads the IPFIX messages of a stream, delimited by the length in their
+// header, until the exporter closes it
+func (c *ipfixCollector) serveStream(conn net.Conn, s *collectorSession) {
+	defer conn.Close()
+
+	for {
+		msg := make([]byte, ipfix.IPFIX_HEADER_LEN)
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("%s: %v", s.name, err)
+			}
+			return
+		}
+		length := int(binary.BigEndian.Uint16(msg[2:4]))
+		if length < ipfix.IPFIX_HEADER_LEN {
+			// Message boundaries are lost
+			log.Printf("%s: invalid message length %d, closing", s.name, length)
+			c.stats.decodeErrors.Add(1)
+			return
+		}
+		msg = append(msg, make([]byte, length-ipfix.IPFIX_HEADER_LEN)...)
+		if _, err := io.ReadFull(conn, msg[ipfix.IPFIX_HEADER_LEN:]); err != nil {
+			log.Printf("%s: %v", s.name, err)
+			return
+		}
+		c.handle(s, msg)
+	}
+}
+
+// Decodes a message of a session, checks its sequence number and prints its
+// traces
+func (c *ipfixCollector) handle(s *collectorSession, msg []byte) {
+	header, traces, err := s.decoder.Decode(msg)
+	if err != nil {
+		log.Printf("%s: %v", s.name, err)
+		c.stats.decodeErrors.Add(1)
+		// The number of records is unknown, resynchronise on the next message
+		delete(s.sequences, header.DomainID)
+		return
+	}
+	c.stats.messages.Add(1)
+	c.stats.records.Add(uint64(len(traces)))
+
+	// The sequence number counts the data records sent before the message
+	if expected, ok := s.sequences[header.DomainID]; ok && header.SeqNumber != expected {
+		log.Printf("%s: domain %d: sequence number %d, expected %d", s.name, header.DomainID, header.SeqNumber, expected)
+		c.stats.sequenceErrors.Add(1)
+	}
+	s.sequences[header.DomainID] = header.SeqNumber + uint32(len(traces))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, trace := range traces {
+		printTrace(c.out, trace)
+	}
+}
+
+// Prints a trace in the console output format: the trace fields, then every
+// hop indented, prefixed with the trace ID
+func printTrace(w io.Writer, trace ioam.IoamTrace) {
+	hops := trace.Hops
+	trace.Hops = nil
+	fmt.Fprintf(w, "%+v\n", trace)
+	for _, hop := range hops {
+		fmt.Fprintf(w, "  TraceId:%d %+v\n", trace.TraceId, hop)
+	}
+	fmt.Fprintln(w)
+}
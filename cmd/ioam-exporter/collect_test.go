@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/export"
+	"github.com/Advanced-Observability/ioam-exporter/internal/ioamtest"
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/Advanced-Observability/ioam-exporter/ipfix"
+)
+
+// Output of the collector, written by several sessions
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestCollectEndToEnd(t *testing.T) {
+	for _, transport := range []string{export.TRANSPORT_UDP, export.TRANSPORT_TCP} {
+		for _, enc := range []string{export.ENCODING_FLAT, export.ENCODING_TRACE} {
+			var out syncBuffer
+			c := newIPFIXCollector(&out)
+			var addr string
+			if transport == export.TRANSPORT_UDP {
+				pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer pc.Close()
+				go c.serveUDP(pc)
+				addr = pc.LocalAddr().String()
+			} else {
+				l, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer l.Close()
+				go c.serveTCP(l)
+				addr = l.Addr().String()
+			}
+
+			e, err := export.NewExporter(transport+"://"+addr, export.Config{MTU: export.DEFAULT_MTU, Encoding: enc})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want bytes.Buffer
+			for i := range uint32(5) {
+				const traceType = 0xFFF000 | ioam.TRACE_TYPE_BIT22_MASK
+				trace := ioamtest.Trace(traceType, ioam.IOAM6_OPTION_TYPE_PREALLOC, ioam.TraceHeader{NodeLen: uint8(ioam.PtoNodeLen(traceType))},
+					ioamtest.Node(traceType, i+1), ioamtest.Node(traceType, i+2))
+				trace.ReceivedAt = time.UnixMilli(1700000000000 + int64(i))
+				tagTrace(&trace, uint64(i), false)
+				if err := e.Export(trace); err != nil {
+					t.Fatal(err)
+				}
+				if enc == export.ENCODING_TRACE {
+					printTrace(&want, trace)
+					continue
+				}
+				// Every flat record is a trace of its own, without the
+				// undefined bits and the receive time
+				for _, hop := range trace.Hops {
+					flat := trace
+					flat.TraceType &= ioamtest.DefinedFieldsMask | ioam.TRACE_TYPE_BIT22_MASK
+					flat.ReceivedAt = time.Time{}
+					flat.Hops = []ioam.IoamNode{hop}
+					printTrace(&want, flat)
+				}
+			}
+			e.Close()
+
+			deadline := time.Now().Add(2 * time.Second)
+			for out.String() != want.String() && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if got := out.String(); got != want.String() {
+				t.Errorf("%s/%s: collector printed\n%s\nwant\n%s", transport, enc, got, want.String())
+			}
+			if c.stats.sequenceErrors.Load() != 0 || c.stats.decodeErrors.Load() != 0 {
+				t.Errorf("%s/%s: %d sequence errors, %d decode errors", transport, enc,
+					c.stats.sequenceErrors.Load(), c.stats.decodeErrors.Load())
+			}
+		}
+	}
+}
+
+func TestPrintTrace(t *testing.T) {
+	trace := ioam.IoamTrace{TraceType: ioam.TRACE_TYPE_BIT0_MASK, TraceId: 42, Hops: make([]ioam.IoamNode, 2)}
+	tagTrace(&trace, 42, false)
+
+	var out strings.Builder
+	printTrace(&out, trace)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n\n"), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], "TraceId:42") {
+		t.Fatalf("printed\n%s", out.String())
+	}
+	for i, line := range lines[1:] {
+		if want := fmt.Sprintf("  TraceId:42 %+v", trace.Hops[i]); line != want {
+			t.Errorf("hop %d printed as %q, want %q", i, line, want)
+		}
+	}
+}
+
+func TestCollectSequenceGap(t *testing.T) {
+	var out strings.Builder
+	c := newIPFIXCollector(&out)
+	s := newCollectorSession("test")
+
+	trace := ioam.IoamTrace{TraceType: ioam.TRACE_TYPE_BIT2_MASK, Hops: make([]ioam.IoamNode, 2)}
+	seqNum := uint32(10)
+	for i := range 3 {
+		msg, err := ipfix.CreateIPFIXMessage(ipfix.IPFIX_DOMAIN_ID, trace, &seqNum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			continue // lost
+		}
+		c.handle(s, msg)
+	}
+
+	if got := c.stats.sequenceErrors.Load(); got != 1 {
+		t.Errorf("%d sequence errors, want 1", got)
+	}
+	if got := c.stats.records.Load(); got != 4 {
+		t.Errorf("%d records, want 4", got)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+const (
+	STATS_FILE = "./exporterStats"
+
+	DEFAULT_COLLECT_ADDRESS = ":4739" // IANA port for IPFIX
+
+	SOURCE_AUTO     = "auto"     // kernel events, or packet capture when the kernel does not send them
+	SOURCE_NETLINK  = "netlink"  // IOAM6 generic netlink events of the kernel
+	SOURCE_AFPACKET = "afpacket" // capture of the IOAM packets with an AF_PACKET socket
+	SOURCE_DEX      = "dex"      // DEX export packets of remote nodes over UDP
+
+	DEFAULT_DEX_ADDRESS = ":9326" // arbitrary, no port is assigned to DEX exports
+
+	DEFAULT_GENERATE_TRACE_TYPE = 0xF00000 // bits 0 to 3
+	DEFAULT_GENERATE_HOPS       = 5
+
+	DEFAULT_QUEUE_SIZE = 4096
+	QUEUE_POLICY_BLOCK = "block" // wait for room in the parser queue
+	QUEUE_POLICY_DROP  = "drop"  // discard the message when the parser queue is full
+)
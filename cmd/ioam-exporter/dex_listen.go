@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/Advanced-Observability/ioam-exporter/ipfix"
+)
+
+// Receives the DEX export packets of remote nodes over UDP and feeds them to
+// the pipeline until SIGINT/SIGTERM
+func receiveDexExports(addr string) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		log.Fatalf("failed to listen for DEX exports: %v", err)
+	}
+
+	p, stop := startPipeline()
+	defer stop()
+
+	var stopping atomic.Bool
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		stopping.Store(true)
+		conn.Close()
+	}()
+
+	log.Printf("[IOAM Exporter] Receiving DEX exports on %s...", conn.LocalAddr())
+	if err := serveDexExports(conn, p); err != nil && !stopping.Load() {
+		log.Printf("failed to receive DEX exports: %v", err)
+	}
+	log.Println("[IOAM Exporter] Stopping...")
+}
+
+// Decodes every DEX export packet received on conn and hands the trace,
+// tagged with the address of its sender, to the pipeline. Returns when conn
+// fails.
+func serveDexExports(conn net.PacketConn, p *pipeline) error {
+	buf := make([]byte, ipfix.IPFIX_MAX_MESSAGE_LEN)
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		// The buffer is reused, the snapshot must not refer to it
+		trace, err := ioam.ParseDexExport(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			log.Printf("DEX export from %v: %v", addr, err)
+			p.countParseError(err)
+			continue
+		}
+		if udpAddr, ok := addr.(*net.UDPAddr); ok {
+			// IPv4 senders of dual-stack sockets are IPv4-mapped
+			trace.ExportingNode = udpAddr.AddrPort().Addr().Unmap()
+		}
+		trace.ReceivedAt = time.Now()
+
+		p.submitTrace(trace)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/internal/ioamtest"
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+)
+
+func TestServeDexExports(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &pipeline{
+		exportQueue: make(chan ioam.IoamTrace, 4),
+		stats:       pipelineStats{parseErrorClasses: make([]atomic.Uint64, len(ioam.ErrorClasses))},
+	}
+	done := make(chan error)
+	go func() { done <- serveDexExports(conn, p) }()
+
+	sender, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	want := ioamtest.Trace(0xF00000, ioam.IOAM6_OPTION_TYPE_DEX, ioam.TraceHeader{}, ioamtest.Node(0xF00000, 1))
+	want.DexFlowID, want.HasDexFlowID = 7, true
+	want.DexSeqNum, want.HasDexSeqNum = 8, true
+	// A malformed packet is skipped
+	for _, packet := range [][]byte{{1, 2, 3}, ioamtest.DexExportPacket(want)} {
+		if _, err := sender.Write(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case trace := <-p.exportQueue:
+		if trace.ReceivedAt.IsZero() {
+			t.Error("no receive time")
+		}
+		want.ReceivedAt = trace.ReceivedAt
+		want.ExportingNode = netip.MustParseAddr("127.0.0.1")
+		want.TraceId = 1
+		if !ioamtest.EqualTraces(trace, want) {
+			t.Errorf("got  %+v\nwant %+v", trace, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no node exported")
+	}
+	if p.stats.parseErrors.Load() != 1 {
+		t.Errorf("%d parse errors, want 1", p.stats.parseErrors.Load())
+	}
+
+	conn.Close()
+	if err := <-done; err == nil {
+		t.Error("serving continued after closing the connection")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/generator"
+	"github.com/Advanced-Observability/ioam-exporter/source/netlink"
+	"github.com/mdlayher/genetlink"
+)
+
+// Feeds generated events to the pipeline, or writes them to a capture file,
+// and reports the throughput
+func generateEvents() {
+	g, err := generator.New(genConfig)
+	if err != nil {
+		log.Fatalf("invalid generator options: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	start := time.Now()
+	if generateFile != "" {
+		c, err := netlink.CreateCapture(generateFile)
+		if err != nil {
+			log.Fatalf("failed to create capture file: %v", err)
+		}
+		err = g.Run(ctx, c.Write)
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+	} else {
+		p, stop := startPipeline()
+		err = g.Run(ctx, func(msg genetlink.Message, _ time.Time) error {
+			p.submit(msg)
+			return nil
+		})
+		// Includes the time needed to drain the queues
+		stop()
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("failed to generate events: %v", err)
+	}
+
+	elapsed := time.Since(start)
+	log.Printf("[IOAM Exporter] Generated %d events in %v (%.0f events/s)", g.Events(), elapsed, float64(g.Events())/elapsed.Seconds())
+}
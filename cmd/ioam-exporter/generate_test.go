@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Advanced-Observability/ioam-exporter/generator"
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+)
+
+func TestGeneratedEventsParse(t *testing.T) {
+	for _, config := range []generator.Config{
+		{Kind: generator.KIND_TRACE, TraceType: 0xF00000, Hops: 5},
+		{Kind: generator.KIND_TRACE, TraceType: 0xFFF000 | ioam.TRACE_TYPE_BIT14_MASK, Hops: 2},
+		{Kind: generator.KIND_TRACE, TraceType: ioam.TRACE_TYPE_BIT0_MASK | ioam.TRACE_TYPE_BIT22_MASK, Hops: 3, SnapshotLen: 8},
+		{Kind: generator.KIND_DEX, TraceType: 0xFFF000 | ioam.TRACE_TYPE_BIT12_MASK | ioam.TRACE_TYPE_BIT21_MASK | ioam.TRACE_TYPE_BIT22_MASK, SnapshotLen: 1020, Hops: 1},
+		{Kind: generator.KIND_MIXED, TraceType: 0xF00000, Hops: 4, Namespaces: []uint16{1, 2}},
+	} {
+		g, err := generator.New(config)
+		if err != nil {
+			t.Fatalf("%+v: %v", config, err)
+		}
+		for i := range 4 {
+			msg := g.Next()
+			trace, err := ioam.ReadMessage(msg)
+			if err != nil {
+				t.Fatalf("%+v: event %d: %v", config, i, err)
+			}
+
+			want := config.Hops
+			if msg.Header.Command == ioam.IOAM6_EVENT_TYPE_DEX {
+				want = 1
+			}
+			if len(trace.Hops) != want {
+				t.Fatalf("%+v: event %d has %d hops, want %d", config, i, len(trace.Hops), want)
+			}
+			if trace.TraceType != config.TraceType || len(trace.Hops[0].Snapshot) != config.SnapshotLen {
+				t.Errorf("%+v: event %d: %+v", config, i, trace)
+			}
+			if ns := config.Namespaces; len(ns) > 0 && trace.Namespace != ns[i%len(ns)] {
+				t.Errorf("%+v: event %d in namespace %d", config, i, trace.Namespace)
+			}
+		}
+	}
+}
+
+func TestGeneratorLimits(t *testing.T) {
+	for _, config := range []generator.Config{
+		{Kind: "pot", TraceType: 0xF00000, Hops: 1},
+		{Kind: generator.KIND_TRACE, TraceType: 0xF00000, Hops: 0},
+		{Kind: generator.KIND_TRACE, TraceType: 0xFFF000, Hops: 5}, // 64 bytes per node
+		{Kind: generator.KIND_TRACE, TraceType: ioam.TRACE_TYPE_BIT22_MASK, Hops: 1, SnapshotLen: 6},
+	} {
+		if _, err := generator.New(config); err == nil {
+			t.Errorf("%+v: no error", config)
+		}
+	}
+}
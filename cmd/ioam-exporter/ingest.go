@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/Advanced-Observability/ioam-exporter/source/pcap"
+)
+
+// Feeds the IOAM options of the IPv6 packets of a pcap or pcapng file to the
+// pipeline
+func ingestPackets(fileName string) {
+	f, err := pcap.Open(fileName)
+	if err != nil {
+		log.Fatalf("failed to open packet file: %v", err)
+	}
+	defer f.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	p, stop := startPipeline()
+	defer stop()
+
+	start := time.Now()
+	packets, traces, err := ingestPacketFile(ctx, f, p)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("ingestion stopped: %v", err)
+	}
+	log.Printf("[IOAM Exporter] Read %d packets with %d IOAM options in %v", packets, traces, time.Since(start))
+}
+
+// Hands the traces of the packets of a file to the pipeline until the end of
+// the file or the context is done. Packets which are not IPv6 are skipped;
+// malformed IOAM options are accounted as parse errors. Returns the number of
+// packets and of IOAM options handed to the pipeline.
+func ingestPacketFile(ctx context.Context, f *pcap.File, p *pipeline) (uint64, uint64, error) {
+	var packets, traces uint64
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return packets, traces, err
+		}
+		packet, err := f.Next()
+		if errors.Is(err, io.EOF) {
+			return packets, traces, nil
+		}
+		if err != nil {
+			return packets, traces, err
+		}
+		packets++
+
+		count, err := submitPacketTraces(p, packet.LinkType, packet.Data, packet.Timestamp, "")
+		traces += count
+		switch {
+		case err == nil, errors.Is(err, ioam.ErrNotIPv6):
+		case errors.Is(err, ioam.ErrUnknownLinkType):
+			// Every packet of the interface would fail alike
+			return packets, traces, err
+		default:
+			log.Printf("packet %d: %v", packets, err)
+		}
+	}
+}
+
+// Hands the traces of a captured packet to the pipeline and returns their
+// number. Malformed IOAM options are accounted as parse errors.
+func submitPacketTraces(p *pipeline, linkType uint16, data []byte, receivedAt time.Time, iface string) (uint64, error) {
+	var count uint64
+	traces, err := ioam.ExtractPacketTraces(linkType, data)
+	for _, trace := range traces {
+		if !trace.Empty() {
+			trace.ReceivedAt, trace.Interface = receivedAt, iface
+			p.submitTrace(trace)
+			count++
+		}
+	}
+	if err != nil && !errors.Is(err, ioam.ErrNotIPv6) && !errors.Is(err, ioam.ErrUnknownLinkType) {
+		p.countParseError(err)
+	}
+
+	return count, err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/internal/ioamtest"
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/Advanced-Observability/ioam-exporter/ipfix"
+	"github.com/Advanced-Observability/ioam-exporter/source/pcap"
+)
+
+func TestIngestPacketFile(t *testing.T) {
+	const traceType = 0xF00000
+	trace := ioamtest.Trace(traceType, ioam.IOAM6_OPTION_TYPE_PREALLOC, ioam.TraceHeader{}, ioamtest.Node(traceType, 1), ioamtest.Node(traceType, 2))
+	packets := [][]byte{
+		ioamtest.EthernetFrame(ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(59, ioamtest.TraceOption(1, trace)))),
+		ioamtest.EthernetFrame(ioamtest.IPv6Packet(17, make([]byte, 8))),
+		ioamtest.EthernetFrame(ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(59, []byte{0, ioam.IOAM6_OPTION_TYPE_PREALLOC}))),
+	}
+	timestamps := []time.Time{time.Unix(1700000000, 123456000), time.Unix(1700000001, 0), time.Unix(1700000002, 5000)}
+
+	f, err := pcap.Open(ioamtest.WritePcap(t, ioam.LINKTYPE_ETHERNET, timestamps, packets))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p := newPipeline(1, 16, QUEUE_POLICY_BLOCK, nil, nil)
+	count, traces, err := ingestPacketFile(context.Background(), f, p)
+	p.close()
+	if err != nil || count != 3 || traces != 1 {
+		t.Errorf("%d packets, %d traces, %v", count, traces, err)
+	}
+	if p.stats.exported.Load() != 1 || p.stats.parseErrors.Load() != 1 {
+		t.Errorf("%d exported, %d parse errors", p.stats.exported.Load(), p.stats.parseErrors.Load())
+	}
+}
+
+func TestIngestDexOption(t *testing.T) {
+	dex := []byte{0, ioam.IOAM6_OPTION_TYPE_DEX, 0, 123, 0, ioam.IOAM6_DEX_EXT_FLOW_ID | ioam.IOAM6_DEX_EXT_SEQ_NUM, 0xFF, 0xF0, 0, 0, 0, 0, 0, 7, 0, 0, 0, 8}
+	packet := ioamtest.EthernetFrame(ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(59, dex)))
+
+	f, err := pcap.Open(ioamtest.WritePcap(t, ioam.LINKTYPE_ETHERNET, []time.Time{time.Unix(1700000000, 0)}, [][]byte{packet}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	read, err := f.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	traces, err := ioam.ExtractPacketTraces(read.LinkType, read.Data)
+	if err != nil || len(traces) != 1 {
+		t.Fatalf("%d traces, %v", len(traces), err)
+	}
+	trace := traces[0]
+	if len(trace.Hops) != 0 || trace.Empty() {
+		t.Errorf("got %d hops, want an option without hops", len(trace.Hops))
+	}
+
+	// The console prints no hop line
+	var out strings.Builder
+	printTrace(&out, trace)
+	if strings.Contains(out.String(), "\n  TraceId:") {
+		t.Errorf("printed a hop:\n%s", out.String())
+	}
+
+	// The record holds the option fields only, without node fields even
+	// though the requested trace type has them
+	set, _, err := ipfix.CreateIOAMTemplateSet(ipfix.TEMPLATE_ID, ipfix.TemplateKeyOf(trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []uint16
+	for fields := set[8:]; len(fields) >= 8; fields = fields[8:] {
+		ids = append(ids, binary.BigEndian.Uint16(fields[0:2])&^0x8000)
+	}
+	if want := []uint16{0, 17, 15, 16, 18, 19, 25}; !slices.Equal(ids, want) {
+		t.Errorf("template fields %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/export"
+	"github.com/Advanced-Observability/ioam-exporter/generator"
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/Advanced-Observability/ioam-exporter/ipfix"
+	"github.com/Advanced-Observability/ioam-exporter/source/netlink"
+)
+
+var (
+	collectorAddrs collectorList
+	collectorMode  string  = export.COLLECTOR_MODE_MIRROR
+	consoleOut     bool    = false
+	dexTraceIDs    bool    = false
+	workerCount    int     = 0
+	queueSize      int     = DEFAULT_QUEUE_SIZE
+	queuePolicy    string  = QUEUE_POLICY_BLOCK
+	resolveEvery           = export.DEFAULT_RESOLVE_INTERVAL
+	domainID       uint32  = ipfix.IPFIX_DOMAIN_ID
+	tlsCAFile      string  = ""
+	tlsCertFile    string  = ""
+	tlsKeyFile     string  = ""
+	tlsServerName  string  = ""
+	tplRefresh             = export.DEFAULT_TEMPLATE_REFRESH
+	tplRefreshPkts uint64  = export.DEFAULT_TEMPLATE_REFRESH_PACKETS
+	tplTimeout             = export.DEFAULT_TEMPLATE_TIMEOUT
+	encoding       string  = export.ENCODING_FLAT
+	mtu            int     = export.DEFAULT_MTU
+	batchRecords   int     = export.DEFAULT_BATCH_RECORDS
+	batchLatency           = export.DEFAULT_BATCH_LATENCY
+	quarantineFile string  = ""
+	listenAddr     string  = DEFAULT_COLLECT_ADDRESS
+	generateFile   string  = ""
+	recordFile     string  = ""
+	packetFileName string  = ""
+	eventSource    string  = SOURCE_AUTO
+	dexListenAddr  string  = DEFAULT_DEX_ADDRESS
+	replaySpeed    float64 = 1
+	genConfig              = generator.Config{Kind: generator.KIND_TRACE, TraceType: DEFAULT_GENERATE_TRACE_TYPE, Hops: DEFAULT_GENERATE_HOPS}
+	captureIfaces  []string
+	ioamCount      atomic.Uint64
+	overflowCount  atomic.Uint64
+)
+
+func main() {
+	command := ""
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case "":
+		parseCliOptions(os.Args[1:], true)
+		if packetFileName != "" {
+			ingestPackets(packetFileName)
+		} else {
+			receiveEvents()
+		}
+	case "collect":
+		parseCollectOptions(os.Args[2:])
+		log.Fatal(runCollector(listenAddr, os.Stdout))
+	case "generate":
+		addGenerateOptions()
+		parseCliOptions(os.Args[2:], false)
+		generateEvents()
+	case "replay":
+		addReplayOptions()
+		parseCliOptions(os.Args[2:], false)
+		if flag.NArg() == 0 {
+			fmt.Println("Give the capture file to replay")
+			os.Exit(1)
+		}
+		// Parsing stops at the file, later flags would be ignored
+		if flag.NArg() > 1 {
+			fmt.Println("Options must come before the capture file, unexpected arguments: " + strings.Join(flag.Args()[1:], " "))
+			os.Exit(1)
+		}
+		replayEvents(flag.Arg(0), replaySpeed)
+	default:
+		fmt.Println("Unknown command " + command)
+		os.Exit(1)
+	}
+}
+
+// Receives the IOAM events of the kernel until SIGINT/SIGTERM. Without kernel
+// support and with the auto source, captures the IOAM packets instead. Other
+// sources replace the kernel events.
+func receiveEvents() {
+	switch eventSource {
+	case SOURCE_AFPACKET:
+		capturePackets(captureIfaces)
+		return
+	case SOURCE_DEX:
+		receiveDexExports(dexListenAddr)
+		return
+	}
+
+	conn, err := netlink.Listen()
+	if err != nil {
+		if eventSource == SOURCE_AUTO && errors.Is(err, netlink.ErrNoIoamEvents) {
+			log.Printf("%v, capturing IOAM packets instead", err)
+			if recordFile != "" {
+				log.Println("netlink messages are not recorded when capturing packets")
+			}
+			capturePackets(captureIfaces)
+			return
+		}
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	var recorder *netlink.CaptureWriter
+	if recordFile != "" {
+		if recorder, err = netlink.CreateCapture(recordFile); err != nil {
+			log.Fatalf("failed to open capture file: %v", err)
+		}
+		defer recorder.Close()
+	}
+
+	p, stop := startPipeline()
+	defer stop()
+
+	// Stop receiving on SIGINT/SIGTERM so that queued traces are exported and
+	// templates withdrawn before exiting
+	var stopping atomic.Bool
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		stopping.Store(true)
+		conn.Close()
+	}()
+
+	// Message receiving loop
+	for {
+		messages, _, err := conn.Receive()
+		if err != nil {
+			if stopping.Load() {
+				log.Println("[IOAM Exporter] Stopping...")
+				return
+			}
+			// Assume that the error is due to a buffer overflow (ENOBUFS)
+			overflowCount.Add(1)
+		}
+
+		receivedAt := time.Now()
+		for _, msg := range messages {
+			if recorder != nil {
+				if err := recorder.Write(msg, receivedAt); err != nil {
+					log.Printf("failed to record message: %v", err)
+				}
+			}
+			p.submitAt(msg, receivedAt)
+		}
+	}
+}
+
+// Sets up the collectors and starts the processing pipeline. The returned
+// function exports the queued traces, withdraws the templates and closes the
+// collectors.
+func startPipeline() (*pipeline, func()) {
+	var collectors *export.CollectorSet
+	if len(collectorAddrs) > 0 {
+		// Credentials are only loaded for TLS and DTLS collectors, or to
+		// report invalid TLS options
+		var creds *export.TLSCredentials
+		tlsFlags := tlsCAFile != "" || tlsCertFile != "" || tlsKeyFile != "" || tlsServerName != ""
+		if tlsFlags || slices.ContainsFunc(collectorAddrs, export.UsesTLS) {
+			var err error
+			if creds, err = export.LoadTLSCredentials(tlsCAFile, tlsCertFile, tlsKeyFile, tlsServerName); err != nil {
+				log.Fatalf("failed to load TLS credentials: %v", err)
+			}
+			if tlsCAFile != "" || tlsCertFile != "" {
+				go creds.ReloadOnSighup()
+			}
+		}
+
+		var err error
+		collectors, err = export.NewCollectorSet(collectorAddrs, collectorMode, export.Config{
+			DomainID:               domainID,
+			ResolveInterval:        resolveEvery,
+			Creds:                  creds,
+			TemplateRefresh:        tplRefresh,
+			TemplateRefreshPackets: tplRefreshPkts,
+			TemplateTimeout:        tplTimeout,
+			Encoding:               encoding,
+			MTU:                    mtu,
+			BatchRecords:           batchRecords,
+			BatchLatency:           batchLatency,
+		})
+		if err != nil {
+			log.Fatalf("invalid collector: %v", err)
+		}
+	}
+
+	var q *quarantine
+	if quarantineFile != "" {
+		var err error
+		if q, err = openQuarantine(quarantineFile); err != nil {
+			log.Fatalf("failed to open quarantine file: %v", err)
+		}
+	}
+
+	p := newPipeline(workerCount, queueSize, queuePolicy, collectors, q)
+
+	go writeStats(STATS_FILE, p)
+	log.Println("[IOAM Exporter] Started...")
+
+	return p, func() {
+		p.close()
+		if collectors != nil {
+			collectors.Close()
+		}
+		if q != nil {
+			q.close()
+		}
+	}
+}
+
+// Writes the number of received IOAM messages and the pipeline counters to a file
+func writeStats(fileName string, p *pipeline) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
+	if err != nil {
+		log.Fatalf("Error opening stats file: %v", err)
+	}
+	defer file.Close()
+
+	var buf bytes.Buffer
+	for range ticker.C {
+		// Update file statistics
+		buf.Reset()
+		printStats(&buf, p)
+		if _, err := file.WriteAt(buf.Bytes(), 0); err != nil {
+			log.Fatalf("Error writing to stats file: %v", err)
+		}
+		if err := file.Truncate(int64(buf.Len())); err != nil {
+			log.Fatalf("Error writing to stats file: %v", err)
+		}
+	}
+}
+
+// Prints the global, pipeline, namespace and collector counters, one
+// tab-separated line per counter
+func printStats(w io.Writer, p *pipeline) {
+	fmt.Fprintf(w, "IOAM messages\t%d\nOverflow errors\t%d\n", ioamCount.Load(), overflowCount.Load())
+	fmt.Fprintf(w,
+		"Received\t%d\nParser queue\t%d/%d\nBlocked (queue full)\t%d\nDropped (queue full)\t%d\n"+
+			"Parsed\t%d\nParse errors\t%d\nExport queue\t%d/%d\nEncode errors\t%d\n",
+		p.stats.received.Load(), len(p.parseQueue), cap(p.parseQueue), p.stats.blocked.Load(), p.stats.dropped.Load(),
+		p.stats.parsed.Load(), p.stats.parseErrors.Load(), len(p.exportQueue), cap(p.exportQueue),
+		p.stats.encodeErrors.Load())
+	for i, class := range ioam.ErrorClasses {
+		fmt.Fprintf(w, "Parse errors (%v)\t%d\n", class, p.stats.parseErrorClasses[i].Load())
+	}
+	namespaces, overflows := p.overflows.snapshot()
+	for i, ns := range namespaces {
+		fmt.Fprintf(w, "Overflowed traces (namespace %d)\t%d\n", ns, overflows[i])
+	}
+	namespaces, counters := p.e2e.Snapshot()
+	for i, ns := range namespaces {
+		fmt.Fprintf(w, "E2E namespace\t%d\nE2E received\t%d\nE2E lost\t%d\nE2E reordered\t%d\nE2E duplicates\t%d\n",
+			ns, counters[i].Received, counters[i].Lost, counters[i].Reordered, counters[i].Duplicates)
+	}
+	if c := p.collectors; c != nil {
+		fmt.Fprintf(w, "No collector available\t%d\n", c.Unavailable.Load())
+		for _, e := range c.Exporters {
+			fmt.Fprintf(w,
+				"Collector\t%s\nState\t%s\nSent messages\t%d\nSent records\t%d\nSent bytes\t%d\nSend errors\t%d\nConnect errors\t%d\nDropped records\t%d\nReconnects\t%d\n",
+				e.Name(), e.State(), e.Stats.Sent.Load(), e.Stats.Records.Load(), e.Stats.Bytes.Load(), e.Stats.SendErrors.Load(),
+				e.Stats.DialErrors.Load(), e.Stats.Dropped.Load(), e.Stats.Reconnects.Load())
+		}
+	}
+}
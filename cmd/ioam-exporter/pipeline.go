@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/export"
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/mdlayher/genetlink"
+)
+
+// Per-stage counters of the processing pipeline
+type pipelineStats struct {
+	received     atomic.Uint64 // messages handed to the pipeline
+	blocked      atomic.Uint64 // submissions that waited for room in the parser queue
+	dropped      atomic.Uint64 // messages dropped because the parser queue was full
+	parsed       atomic.Uint64 // messages successfully parsed by a worker
+	parseErrors  atomic.Uint64 // messages rejected by a worker
+	exported     atomic.Uint64 // messages handled by the export stage
+	encodeErrors atomic.Uint64 // IPFIX messages that could not be built
+
+	parseErrorClasses []atomic.Uint64 // rejected messages per class, indexed like ioam.ErrorClasses
+}
+
+// Counter kept per IOAM namespace
+type namespaceCounter struct {
+	mu     sync.Mutex
+	counts map[uint16]uint64
+}
+
+// Netlink message waiting to be parsed
+type pipelineEvent struct {
+	msg        genetlink.Message
+	traceID    uint64
+	receivedAt time.Time
+}
+
+// Fixed-size pool of parser workers fed by a bounded queue, followed by a
+// single export stage which serialises console output and IPFIX encoding
+type pipeline struct {
+	policy      string
+	parseQueue  chan pipelineEvent
+	exportQueue chan ioam.IoamTrace
+	traceIDs    atomic.Uint64        // last trace ID assigned to a received message
+	collectors  *export.CollectorSet // nil when no collector is configured, only used by the export stage
+	quarantine  *quarantine          // nil when malformed messages are not kept
+	stats       pipelineStats
+	e2e         ioam.E2ETracker  // only updated by the export stage
+	overflows   namespaceCounter // traces with the overflow flag, only updated by the export stage
+
+	workers sync.WaitGroup
+	export  sync.WaitGroup
+}
+
+// Creates and starts a pipeline with the given number of parser workers
+func newPipeline(workers int, queueSize int, policy string, collectors *export.CollectorSet, q *quarantine) *pipeline {
+	p := &pipeline{
+		policy:      policy,
+		collectors:  collectors,
+		quarantine:  q,
+		stats:       pipelineStats{parseErrorClasses: make([]atomic.Uint64, len(ioam.ErrorClasses))},
+		parseQueue:  make(chan pipelineEvent, queueSize),
+		exportQueue: make(chan ioam.IoamTrace, queueSize),
+	}
+
+	p.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.parseWorker()
+	}
+
+	p.export.Add(1)
+	go p.exportStage()
+
+	return p
+}
+
+// Hands a netlink message received now to the parser workers, applying the
+// queue policy when the queue is full. Every message gets the next trace ID,
+// even if it is dropped.
+func (p *pipeline) submit(msg genetlink.Message) {
+	p.submitAt(msg, time.Now())
+}
+
+// Hands a netlink message received at the given time, e.g. recorded in a
+// capture file, to the parser workers, as submit
+func (p *pipeline) submitAt(msg genetlink.Message, receivedAt time.Time) {
+	p.stats.received.Add(1)
+	event := pipelineEvent{msg: msg, traceID: p.traceIDs.Add(1), receivedAt: receivedAt}
+
+	select {
+	case p.parseQueue <- event:
+		return
+	default:
+	}
+
+	if p.policy == QUEUE_POLICY_DROP {
+		p.stats.dropped.Add(1)
+		return
+	}
+
+	p.stats.blocked.Add(1)
+	p.parseQueue <- event
+}
+
+// Hands a trace decoded elsewhere, e.g. from a captured packet, directly to
+// the export stage, applying the queue policy when the export queue is full
+func (p *pipeline) submitTrace(trace ioam.IoamTrace) {
+	p.stats.received.Add(1)
+	tagTrace(&trace, p.traceIDs.Add(1), dexTraceIDs)
+
+	select {
+	case p.exportQueue <- trace:
+		p.stats.parsed.Add(1)
+		return
+	default:
+	}
+
+	if p.policy == QUEUE_POLICY_DROP {
+		p.stats.dropped.Add(1)
+		return
+	}
+
+	p.stats.blocked.Add(1)
+	p.exportQueue <- trace
+	p.stats.parsed.Add(1)
+}
+
+// Stops accepting messages and waits until every queued message is exported
+func (p *pipeline) close() {
+	close(p.parseQueue)
+	p.workers.Wait()
+	close(p.exportQueue)
+	p.export.Wait()
+}
+
+// Parses queued netlink messages and forwards the traces to the export stage
+func (p *pipeline) parseWorker() {
+	defer p.workers.Done()
+
+	for event := range p.parseQueue {
+		trace, err := ioam.ReadMessage(event.msg)
+		if err != nil {
+			p.parseFailed(event.msg, err)
+			continue
+		}
+		if trace.Empty() {
+			continue
+		}
+		trace.ReceivedAt = event.receivedAt
+		tagTrace(&trace, event.traceID, dexTraceIDs)
+
+		p.stats.parsed.Add(1)
+		p.exportQueue <- trace
+	}
+}
+
+// Accounts a message rejected by the parser and quarantines it
+func (p *pipeline) parseFailed(msg genetlink.Message, err error) {
+	log.Printf("failed to parse IOAM event: %v", err)
+	p.countParseError(err)
+
+	if p.quarantine != nil {
+		p.quarantine.add(msg, err)
+	}
+}
+
+// Accounts a parse error in its class
+func (p *pipeline) countParseError(err error) {
+	p.stats.parseErrors.Add(1)
+	for i, class := range ioam.ErrorClasses {
+		if errors.Is(err, class) {
+			p.stats.parseErrorClasses[i].Add(1)
+			break
+		}
+	}
+}
+
+// Prints and exports parsed traces, one at a time
+func (p *pipeline) exportStage() {
+	defer p.export.Done()
+
+	for trace := range p.exportQueue {
+		if ioam.HasTraceHeader(trace.OptionType) && trace.Header.Overflow() {
+			p.overflows.add(trace.Namespace)
+		}
+		if trace.OptionType == ioam.IOAM6_OPTION_TYPE_E2E {
+			p.e2e.Observe(trace)
+		}
+
+		if consoleOut {
+			printTrace(os.Stdout, trace)
+		}
+
+		if p.collectors != nil {
+			// Transport errors are accounted in the exporter stats
+			if err := p.collectors.Export(trace); err != nil && errors.Is(err, export.ErrEncoding) {
+				log.Printf("could not create ipfix message: %v", err)
+				p.stats.encodeErrors.Add(1)
+			}
+		}
+
+		p.stats.exported.Add(1)
+		ioamCount.Add(1)
+	}
+}
+
+// Sets the trace ID of a trace and the hop index of its nodes. With dexIDs,
+// the trace ID of DEX traces carrying a flow ID and a sequence number is
+// derived from them, so that it is stable across exporters.
+func tagTrace(trace *ioam.IoamTrace, traceID uint64, dexIDs bool) {
+	trace.TraceId = traceID
+	if dexIDs && trace.HasDexFlowID && trace.HasDexSeqNum {
+		trace.TraceId = uint64(trace.DexFlowID)<<32 | uint64(trace.DexSeqNum)
+	}
+	for i := range trace.Hops {
+		trace.Hops[i].HopIndex = uint8(i)
+	}
+}
+
+// Increments the counter of a namespace
+func (c *namespaceCounter) add(namespace uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[uint16]uint64)
+	}
+	c.counts[namespace]++
+}
+
+// Returns the counters of every namespace, sorted by namespace
+func (c *namespaceCounter) snapshot() ([]uint16, []uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	namespaces := make([]uint16, 0, len(c.counts))
+	for ns := range c.counts {
+		namespaces = append(namespaces, ns)
+	}
+	slices.Sort(namespaces)
+	counts := make([]uint64, len(namespaces))
+	for i, ns := range namespaces {
+		counts[i] = c.counts[ns]
+	}
+	return namespaces, counts
+}
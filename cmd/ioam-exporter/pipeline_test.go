@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/export"
+	"github.com/Advanced-Observability/ioam-exporter/generator"
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/mdlayher/genetlink"
+)
+
+func TestTagTrace(t *testing.T) {
+	trace := ioam.IoamTrace{Hops: make([]ioam.IoamNode, 3)}
+	tagTrace(&trace, 5, false)
+	if trace.TraceId != 5 {
+		t.Errorf("trace ID %d, want 5", trace.TraceId)
+	}
+	for i, node := range trace.Hops {
+		if node.HopIndex != uint8(i) {
+			t.Errorf("node %d: hop %d", i, node.HopIndex)
+		}
+	}
+
+	tagTrace(&trace, 6, true)
+	if trace.TraceId != 6 {
+		t.Errorf("trace ID %d, want 6", trace.TraceId)
+	}
+	dex := ioam.IoamTrace{DexFlowID: 1, DexSeqNum: 2, HasDexFlowID: true, HasDexSeqNum: true, Hops: make([]ioam.IoamNode, 1)}
+	tagTrace(&dex, 7, true)
+	if got, want := dex.TraceId, uint64(1)<<32|2; got != want {
+		t.Errorf("DEX trace ID %#x, want %#x", got, want)
+	}
+}
+
+func TestPipelineOverflowCount(t *testing.T) {
+	p := newPipeline(1, 4, QUEUE_POLICY_BLOCK, nil, nil)
+	overflow := ioam.TraceHeader{NodeLen: 1, Flags: ioam.IOAM6_TRACE_FLAG_OVERFLOW}
+	p.submitTrace(ioam.IoamTrace{Namespace: 1, Header: overflow, Hops: make([]ioam.IoamNode, 2)})
+	p.submitTrace(ioam.IoamTrace{Namespace: 1, OptionType: ioam.IOAM6_OPTION_TYPE_INCREMENTAL, Header: overflow, Hops: make([]ioam.IoamNode, 1)})
+	p.submitTrace(ioam.IoamTrace{Namespace: 2, Header: ioam.TraceHeader{NodeLen: 1}, Hops: make([]ioam.IoamNode, 1)})
+	// Only trace options have a header
+	p.submitTrace(ioam.IoamTrace{Namespace: 3, OptionType: ioam.IOAM6_OPTION_TYPE_DEX, Header: overflow, Hops: make([]ioam.IoamNode, 1)})
+	p.close()
+
+	namespaces, counts := p.overflows.snapshot()
+	if len(namespaces) != 1 || namespaces[0] != 1 || counts[0] != 2 {
+		t.Errorf("overflowed traces %v per namespace %v, want 2 in namespace 1", counts, namespaces)
+	}
+}
+
+func TestSubmitQueuePolicy(t *testing.T) {
+	// Without parser workers, the parser queue holds a single message
+	newStalled := func(policy string) *pipeline {
+		return &pipeline{policy: policy, parseQueue: make(chan pipelineEvent, 1)}
+	}
+	var msg genetlink.Message
+
+	p := newStalled(QUEUE_POLICY_DROP)
+	p.submit(msg)
+	p.submit(msg)
+	if p.stats.received.Load() != 2 || p.stats.dropped.Load() != 1 || p.stats.blocked.Load() != 0 {
+		t.Errorf("drop: %d received, %d dropped, %d blocked, want 2, 1 and 0", p.stats.received.Load(), p.stats.dropped.Load(), p.stats.blocked.Load())
+	}
+
+	p = newStalled(QUEUE_POLICY_BLOCK)
+	p.submit(msg)
+	done := make(chan struct{})
+	go func() {
+		p.submit(msg)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.stats.blocked.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	<-p.parseQueue
+	<-done
+	if p.stats.blocked.Load() != 1 || p.stats.dropped.Load() != 0 || len(p.parseQueue) != 1 {
+		t.Errorf("block: %d blocked, %d dropped, want 1 and 0", p.stats.blocked.Load(), p.stats.dropped.Load())
+	}
+}
+
+func TestPipelineCloseDrains(t *testing.T) {
+	g, err := generator.New(generator.Config{Kind: generator.KIND_TRACE, TraceType: 0xF00000, Hops: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := newPipeline(4, 8, QUEUE_POLICY_BLOCK, nil, nil)
+	for range 200 {
+		p.submit(g.Next())
+	}
+	p.close()
+
+	if p.stats.parsed.Load() != 200 || p.stats.exported.Load() != 200 {
+		t.Errorf("%d parsed, %d exported, want 200", p.stats.parsed.Load(), p.stats.exported.Load())
+	}
+	if len(p.parseQueue) != 0 || len(p.exportQueue) != 0 {
+		t.Errorf("%d messages and %d traces left in the queues", len(p.parseQueue), len(p.exportQueue))
+	}
+}
+
+// With several parser workers, the single export stage still numbers the
+// IPFIX messages without gap nor duplicate
+func TestPipelineSequenceNumbers(t *testing.T) {
+	const events, hops = 100, 2
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	received := make(chan []uint32)
+	go func() {
+		var seqNums []uint32
+		buf := make([]byte, 65535)
+		for len(seqNums) < events {
+			pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+			n, _, err := pc.ReadFrom(buf)
+			if err != nil || n < 16 {
+				break
+			}
+			seqNums = append(seqNums, binary.BigEndian.Uint32(buf[8:12]))
+		}
+		received <- seqNums
+	}()
+
+	collectors, err := export.NewCollectorSet([]string{pc.LocalAddr().String()}, export.COLLECTOR_MODE_MIRROR, export.Config{MTU: export.DEFAULT_MTU})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := generator.New(generator.Config{Kind: generator.KIND_TRACE, TraceType: 0xF00000, Hops: hops})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newPipeline(8, 4, QUEUE_POLICY_BLOCK, collectors, nil)
+	for range events {
+		p.submit(g.Next())
+	}
+	p.close()
+	collectors.Close()
+
+	seqNums := <-received
+	slices.Sort(seqNums)
+	if len(seqNums) != events {
+		t.Fatalf("received %d messages, want %d", len(seqNums), events)
+	}
+	for i, seqNum := range seqNums {
+		if seqNum != uint32(i*hops) {
+			t.Fatalf("sequence numbers %v, want multiples of %d", seqNums, hops)
+		}
+	}
+}
+
+func TestSubmitTraceQueuePolicy(t *testing.T) {
+	// Without export stage, the export queue holds a single trace
+	newStalled := func(policy string) *pipeline {
+		return &pipeline{policy: policy, exportQueue: make(chan ioam.IoamTrace, 1)}
+	}
+	trace := ioam.IoamTrace{Hops: make([]ioam.IoamNode, 1)}
+
+	p := newStalled(QUEUE_POLICY_DROP)
+	p.submitTrace(trace)
+	p.submitTrace(trace)
+	if p.stats.dropped.Load() != 1 || p.stats.parsed.Load() != 1 || len(p.exportQueue) != 1 {
+		t.Errorf("drop: %d dropped, %d parsed, want 1 and 1", p.stats.dropped.Load(), p.stats.parsed.Load())
+	}
+
+	p = newStalled(QUEUE_POLICY_BLOCK)
+	p.submitTrace(trace)
+	done := make(chan struct{})
+	go func() {
+		p.submitTrace(trace)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for p.stats.blocked.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	<-p.exportQueue
+	<-done
+	if p.stats.blocked.Load() != 1 || p.stats.dropped.Load() != 0 || p.stats.parsed.Load() != 2 {
+		t.Errorf("block: %d blocked, %d dropped, %d parsed, want 1, 0 and 2", p.stats.blocked.Load(), p.stats.dropped.Load(), p.stats.parsed.Load())
+	}
+}
+
+func TestPipelineParseErrorClasses(t *testing.T) {
+	p := newPipeline(1, 4, QUEUE_POLICY_BLOCK, nil, nil)
+	p.submit(genetlink.Message{Header: genetlink.Header{Command: 42}})
+	p.submit(genetlink.Message{Header: genetlink.Header{Command: ioam.IOAM6_EVENT_TYPE_TRACE}, Data: []byte{1, 2, 3}})
+	p.close()
+
+	for i, class := range ioam.ErrorClasses {
+		want := uint64(0)
+		if class == ioam.ErrUnknownCommand || class == ioam.ErrBadAttributes {
+			want = 1
+		}
+		if got := p.stats.parseErrorClasses[i].Load(); got != want {
+			t.Errorf("%v: %d errors, want %d", class, got, want)
+		}
+	}
+	if got := p.stats.parseErrors.Load(); got != 2 {
+		t.Errorf("%d parse errors, want 2", got)
+	}
+
+	var stats strings.Builder
+	printStats(&stats, p)
+	for _, line := range []string{
+		"Parse errors (" + ioam.ErrUnknownCommand.Error() + ")\t1\n",
+		"Parse errors (" + ioam.ErrBadAttributes.Error() + ")\t1\n",
+		"Parse errors (" + ioam.ErrTruncatedNode.Error() + ")\t0\n",
+	} {
+		if !strings.Contains(stats.String(), line) {
+			t.Errorf("stats without %q:\n%s", line, stats.String())
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/genetlink"
+)
+
+// Append-only file keeping the raw payload of malformed netlink messages, so
+// that they can be inspected or replayed later
+type quarantine struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Opens the quarantine file, appending to it if it already exists
+func openQuarantine(fileName string) (*quarantine, error) {
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &quarantine{file: file}, nil
+}
+
+// Writes one line with the time, the command, the error and the hex payload
+func (q *quarantine) add(msg genetlink.Message, cause error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, err := fmt.Fprintf(q.file, "%s\tcmd=%d\t%v\t%s\n", time.Now().Format(time.RFC3339Nano),
+		msg.Header.Command, cause, hex.EncodeToString(msg.Data)); err != nil {
+		log.Printf("failed to write to quarantine file: %v", err)
+	}
+}
+
+func (q *quarantine) close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.file.Close()
+}
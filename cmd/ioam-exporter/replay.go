@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/source/netlink"
+	"github.com/mdlayher/genetlink"
+)
+
+// Feeds the messages of a capture file to the pipeline. With a positive
+// speed, messages are spaced as recorded, divided by the speed; otherwise
+// they are replayed as fast as possible.
+func replayEvents(fileName string, speed float64) {
+	r, err := netlink.OpenCapture(fileName)
+	if err != nil {
+		log.Fatalf("failed to open capture file: %v", err)
+	}
+	defer r.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	p, stop := startPipeline()
+	defer stop()
+
+	start := time.Now()
+	count, err := replayCapture(ctx, r, speed, p.submitAt)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Printf("replay stopped: %v", err)
+	}
+	log.Printf("[IOAM Exporter] Replayed %d messages in %v", count, time.Since(start))
+}
+
+// Hands the messages of a capture file and their recorded receive time to
+// submit, at the given speed, until the end of the file or the context is
+// done. Returns the number of messages.
+func replayCapture(ctx context.Context, r *netlink.CaptureReader, speed float64, submit func(msg genetlink.Message, at time.Time)) (uint64, error) {
+	var first time.Time
+	start := time.Now()
+
+	for count := uint64(0); ; count++ {
+		msg, at, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+
+		if speed > 0 {
+			if first.IsZero() {
+				first = at
+			}
+			due := start.Add(time.Duration(float64(at.Sub(first)) / speed))
+			if wait := time.Until(due); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return count, ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		submit(msg, at)
+	}
+}
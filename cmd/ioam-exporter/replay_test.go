@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/generator"
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/Advanced-Observability/ioam-exporter/source/netlink"
+	"github.com/mdlayher/genetlink"
+)
+
+func TestReplayCaptureSpeed(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "events.cap")
+	c, err := netlink.CreateCapture(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := time.Unix(1700000000, 0)
+	for i := range 3 {
+		msg := genetlink.Message{Header: genetlink.Header{Command: uint8(i)}}
+		if err := c.Write(msg, recorded.Add(time.Duration(i)*200*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		speed    float64
+		min, max time.Duration
+	}{
+		{0, 0, 100 * time.Millisecond},
+		{4, 100 * time.Millisecond, 300 * time.Millisecond},
+	} {
+		r, err := netlink.OpenCapture(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var commands []uint8
+		start := time.Now()
+		count, err := replayCapture(context.Background(), r, tt.speed, func(msg genetlink.Message, _ time.Time) {
+			commands = append(commands, msg.Header.Command)
+		})
+		elapsed := time.Since(start)
+		r.Close()
+
+		if err != nil || count != 3 {
+			t.Fatalf("speed %v: %d messages, %v", tt.speed, count, err)
+		}
+		if commands[0] != 0 || commands[1] != 1 || commands[2] != 2 {
+			t.Errorf("speed %v: messages replayed in order %v", tt.speed, commands)
+		}
+		if elapsed < tt.min || elapsed > tt.max {
+			t.Errorf("speed %v: replayed in %v, want %v to %v", tt.speed, elapsed, tt.min, tt.max)
+		}
+	}
+}
+
+func TestReplayReceiveTime(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "events.cap")
+	g, err := generator.New(generator.Config{Kind: generator.KIND_TRACE, TraceType: 0xF00000, Hops: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := netlink.CreateCapture(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := time.UnixMilli(1700000000123)
+	if err := c.Write(g.Next(), recorded); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	// Without export stage, the parsed traces stay in the export queue
+	p := &pipeline{
+		policy:      QUEUE_POLICY_BLOCK,
+		stats:       pipelineStats{parseErrorClasses: make([]atomic.Uint64, len(ioam.ErrorClasses))},
+		parseQueue:  make(chan pipelineEvent, 1),
+		exportQueue: make(chan ioam.IoamTrace, 1),
+	}
+	p.workers.Add(1)
+	go p.parseWorker()
+
+	r, err := netlink.OpenCapture(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if count, err := replayCapture(context.Background(), r, 0, p.submitAt); err != nil || count != 1 {
+		t.Fatalf("%d messages, %v", count, err)
+	}
+	close(p.parseQueue)
+	p.workers.Wait()
+
+	select {
+	case trace := <-p.exportQueue:
+		if !trace.ReceivedAt.Equal(recorded) {
+			t.Errorf("received at %v, want the recorded %v", trace.ReceivedAt, recorded)
+		}
+	default:
+		t.Fatal("no trace parsed")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/Advanced-Observability/ioam-exporter/export"
+	"github.com/Advanced-Observability/ioam-exporter/generator"
+	"github.com/Advanced-Observability/ioam-exporter/ipfix"
+)
+
+// Parse the CLI options of the collect subcommand
+func parseCollectOptions(args []string) {
+	flags := flag.NewFlagSet("collect", flag.ExitOnError)
+	flags.StringVar(&listenAddr, "l", DEFAULT_COLLECT_ADDRESS, "Address and port on which IPFIX messages are received (UDP and TCP)")
+	flags.Parse(args)
+}
+
+// Add the CLI options of the generate subcommand
+func addGenerateOptions() {
+	flag.StringVar(&genConfig.Kind, "kind", generator.KIND_TRACE, "Kind of generated events ("+
+		generator.KIND_TRACE+", "+generator.KIND_DEX+" or "+generator.KIND_MIXED+")")
+	flag.Func("trace-type", fmt.Sprintf("IOAM trace type of the generated events (default %#06x)", DEFAULT_GENERATE_TRACE_TYPE), func(s string) error {
+		traceType, err := strconv.ParseUint(s, 0, 24)
+		genConfig.TraceType = uint32(traceType)
+		return err
+	})
+	flag.IntVar(&genConfig.Hops, "hops", DEFAULT_GENERATE_HOPS, "Number of nodes of the generated traces")
+	flag.IntVar(&genConfig.SnapshotLen, "snapshot", 0, "Length of the opaque state snapshot of every node, with trace-type bit 22 (multiple of 4)")
+	flag.Func("ns", "IOAM namespace of the generated events, repeatable (default 0)", func(s string) error {
+		namespace, err := strconv.ParseUint(s, 0, 16)
+		genConfig.Namespaces = append(genConfig.Namespaces, uint16(namespace))
+		return err
+	})
+	flag.Float64Var(&genConfig.Rate, "rate", 0, "Generated events per second (0 for as fast as possible)")
+	flag.Uint64Var(&genConfig.Count, "n", 0, "Number of generated events (0 until interrupted)")
+	flag.Int64Var(&genConfig.Seed, "seed", 1, "Seed of the generated field values")
+	flag.StringVar(&generateFile, "write", "", "Capture file receiving the generated events instead of the pipeline")
+}
+
+// Add the CLI options of the replay subcommand
+func addReplayOptions() {
+	flag.Float64Var(&replaySpeed, "speed", 1, "Replay speed relative to the recorded timestamps (0 for as fast as possible)")
+}
+
+// Parse CLI options. Without requireOutput, traces may be neither exported
+// nor printed.
+func parseCliOptions(args []string, requireOutput bool) {
+	// Argument parsing
+	flag.Var(&collectorAddrs, "c", "Collector address and port ([udp|tcp|sctp|tls|dtls://]addr:port), repeatable")
+	flag.StringVar(&collectorMode, "m", export.COLLECTOR_MODE_MIRROR, "Collector mode with several collectors ("+
+		export.COLLECTOR_MODE_MIRROR+", "+export.COLLECTOR_MODE_FAILOVER+" or "+export.COLLECTOR_MODE_HASH+")")
+	domain := flag.Uint64("domain", ipfix.IPFIX_DOMAIN_ID, "IPFIX observation domain ID")
+	flag.DurationVar(&resolveEvery, "resolve", export.DEFAULT_RESOLVE_INTERVAL, "Interval between DNS resolutions of the collector name (0 to disable)")
+	flag.StringVar(&tlsCAFile, "ca", "", "CA bundle verifying the collector certificate (TLS/DTLS, default: system roots)")
+	flag.StringVar(&tlsCertFile, "cert", "", "Client certificate for mutual authentication (TLS/DTLS)")
+	flag.StringVar(&tlsKeyFile, "key", "", "Client private key for mutual authentication (TLS/DTLS)")
+	flag.StringVar(&tlsServerName, "servername", "", "Name expected in the collector certificate (TLS/DTLS, default: collector host)")
+	flag.DurationVar(&tplRefresh, "template-refresh", export.DEFAULT_TEMPLATE_REFRESH, "Interval between template retransmissions over UDP/DTLS (0 to disable)")
+	flag.Uint64Var(&tplRefreshPkts, "template-refresh-packets", export.DEFAULT_TEMPLATE_REFRESH_PACKETS, "Number of messages between template retransmissions over UDP/DTLS (0 to disable)")
+	flag.DurationVar(&tplTimeout, "template-timeout", export.DEFAULT_TEMPLATE_TIMEOUT, "Delay after which unused templates are withdrawn (0 to disable)")
+	flag.StringVar(&encoding, "e", export.ENCODING_FLAT, "IPFIX encoding ("+export.ENCODING_FLAT+": one record per hop, "+export.ENCODING_TRACE+": one record per trace with its hops in a subTemplateList)")
+	flag.IntVar(&mtu, "mtu", export.DEFAULT_MTU, fmt.Sprintf("Maximum size of an IPFIX message (%d to %d bytes)", ipfix.IPFIX_MIN_MTU, ipfix.IPFIX_MAX_MESSAGE_LEN))
+	flag.IntVar(&batchRecords, "batch-records", export.DEFAULT_BATCH_RECORDS, "Maximum number of records per IPFIX message (0 for no limit)")
+	flag.DurationVar(&batchLatency, "batch-latency", export.DEFAULT_BATCH_LATENCY, "Maximum time a record waits for an IPFIX message (0 to send every trace immediately)")
+	flag.BoolVar(&consoleOut, "o", false, "Print traces to console")
+	flag.StringVar(&recordFile, "record", "", "Capture file to which every received netlink message is appended")
+	flag.StringVar(&eventSource, "source", SOURCE_AUTO, "Source of the IOAM data ("+SOURCE_NETLINK+", "+SOURCE_AFPACKET+", "+SOURCE_DEX+
+		" or "+SOURCE_AUTO+" for netlink, or afpacket without kernel support)")
+	flag.StringVar(&dexListenAddr, "dex-listen", DEFAULT_DEX_ADDRESS, "UDP address on which the dex source receives DEX export packets")
+	flag.Func("i", "Interface captured by the afpacket source, repeatable (default: every interface)", func(value string) error {
+		captureIfaces = append(captureIfaces, value)
+		return nil
+	})
+	flag.StringVar(&packetFileName, "r", "", "Read the IOAM options of the IPv6 packets of a pcap or pcapng file instead of the kernel events")
+	flag.StringVar(&quarantineFile, "quarantine", "", "File receiving a hex dump of the netlink payload of malformed events")
+	flag.BoolVar(&dexTraceIDs, "dex-trace-id", false, "Derive the trace ID of DEX traces from their flow ID and sequence number")
+	flag.IntVar(&workerCount, "w", runtime.NumCPU(), "Number of parser workers")
+	flag.IntVar(&queueSize, "q", DEFAULT_QUEUE_SIZE, "Size of the parser and export queues")
+	flag.StringVar(&queuePolicy, "p", QUEUE_POLICY_BLOCK, "Policy when the parser queue is full ("+QUEUE_POLICY_BLOCK+" or "+QUEUE_POLICY_DROP+")")
+	showHelp := flag.Bool("h", false, "View help")
+	flag.CommandLine.Parse(args)
+
+	if *showHelp {
+		flag.PrintDefaults()
+		os.Exit(0)
+	}
+	if requireOutput && len(collectorAddrs) == 0 && !consoleOut {
+		fmt.Println("Use a collector or console print")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	if *domain > math.MaxUint32 {
+		fmt.Println("Observation domain ID must fit in 32 bits")
+		os.Exit(1)
+	}
+	domainID = uint32(*domain)
+	if workerCount < 1 || queueSize < 1 {
+		fmt.Println("Number of workers and queue size must be positive")
+		os.Exit(1)
+	}
+	if queuePolicy != QUEUE_POLICY_BLOCK && queuePolicy != QUEUE_POLICY_DROP {
+		fmt.Println("Unknown queue policy " + queuePolicy)
+		os.Exit(1)
+	}
+	switch eventSource {
+	case SOURCE_AUTO, SOURCE_NETLINK, SOURCE_AFPACKET, SOURCE_DEX:
+	default:
+		fmt.Println("Unknown source " + eventSource)
+		os.Exit(1)
+	}
+	if eventSource != SOURCE_AUTO && eventSource != SOURCE_NETLINK && recordFile != "" {
+		fmt.Println("Only netlink messages can be recorded")
+		os.Exit(1)
+	}
+}
+
+// List of collectors given by repeating a flag
+type collectorList []string
+
+func (l *collectorList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *collectorList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
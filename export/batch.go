@@ -0,0 +1,185 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/Advanced-Observability/ioam-exporter/ipfix"
+)
+
+var errRecordTooLong = errors.New("data record does not fit in an IPFIX message")
+
+// Data records of one template waiting to be exported
+type pendingSet struct {
+	template     *ioamTemplate
+	withTemplate bool // the template is sent along with the records
+	records      bytes.Buffer
+	count        int
+}
+
+// Queues an encoded data record, flushing the pending records first if the
+// message would exceed the MTU. Records are never split across messages.
+func (e *Exporter) addRecord(t *ioamTemplate, record []byte) error {
+	cost := e.recordCost(t, len(record))
+	if e.pendingRecords > 0 && e.pendingSize+cost > e.mtu {
+		if err := e.flush(); err != nil {
+			return err
+		}
+		cost = e.recordCost(t, len(record))
+	}
+
+	// A record larger than the MTU is sent alone, within the IPFIX limit
+	if ipfix.IPFIX_HEADER_LEN+cost > ipfix.IPFIX_MAX_MESSAGE_LEN {
+		return fmt.Errorf("%w: %w (%d bytes)", ErrEncoding, errRecordTooLong, len(record))
+	}
+
+	set := e.pendingSetOf(t)
+	if set == nil {
+		set = &pendingSet{
+			template:     t,
+			withTemplate: e.templates.needsAnnouncement(t, e.reliable()),
+		}
+		e.pending = append(e.pending, set)
+	}
+	if e.pendingRecords == 0 {
+		e.pendingSize = ipfix.IPFIX_HEADER_LEN
+	}
+
+	set.records.Write(record)
+	set.count++
+	e.pendingSize += cost
+	e.pendingRecords++
+
+	if e.pendingSize >= e.mtu || (e.batchRecords > 0 && e.pendingRecords >= e.batchRecords) {
+		return e.flush()
+	}
+	return nil
+}
+
+// Number of bytes a record adds to the pending message: the record itself
+// and, for the first record of a template, a set header and the template
+func (e *Exporter) recordCost(t *ioamTemplate, recordLen int) int {
+	if e.pendingSetOf(t) != nil {
+		return recordLen
+	}
+
+	cost := ipfix.IPFIX_SET_HEADER_LEN + recordLen
+	// On SCTP, templates are sent in their own message on stream 0
+	if e.transport != TRANSPORT_SCTP && e.templates.needsAnnouncement(t, e.reliable()) {
+		cost += len(t.set)
+	}
+	return cost
+}
+
+// Returns the pending records of a template, if any
+func (e *Exporter) pendingSetOf(t *ioamTemplate) *pendingSet {
+	for _, set := range e.pending {
+		if set.template == t {
+			return set
+		}
+	}
+	return nil
+}
+
+// Sends the pending records: one message on UDP, DTLS, TCP and TLS, one
+// message per template on SCTP
+func (e *Exporter) flush() error {
+	if e.flushTimer != nil {
+		e.flushTimer.Stop()
+		e.flushTimer = nil
+	}
+	if e.pendingRecords == 0 {
+		return nil
+	}
+
+	pending, records := e.pending, e.pendingRecords
+	e.pending, e.pendingSize, e.pendingRecords = nil, 0, 0
+
+	if e.conn == nil {
+		e.Stats.Dropped.Add(uint64(records))
+		return errExporterBackoff
+	}
+
+	if e.transport == TRANSPORT_SCTP {
+		// Templates go reliably on stream 0 and data sets on their own stream.
+		// After a failure, the records of this set and the following ones are
+		// dropped.
+		for i, set := range pending {
+			if err := e.flushSCTPSet(set); err != nil {
+				for _, unsent := range pending[i:] {
+					e.Stats.Dropped.Add(uint64(unsent.count))
+				}
+				return err
+			}
+		}
+		return nil
+	}
+
+	var sets [][]byte
+	for _, set := range pending {
+		if set.withTemplate {
+			sets = append(sets, set.template.set)
+		}
+	}
+	for _, set := range pending {
+		data, err := ipfix.CreateDataSet(set.template.id, set.records.Bytes())
+		if err != nil {
+			e.Stats.Dropped.Add(uint64(records))
+			return fmt.Errorf("%w: %v", ErrEncoding, err)
+		}
+		sets = append(sets, data)
+	}
+
+	msg, err := ipfix.WrapIPFIXSets(e.domainID, e.sequences.reserve(e.domainID, records), sets...)
+	if err != nil {
+		e.Stats.Dropped.Add(uint64(records))
+		return fmt.Errorf("%w: %v", ErrEncoding, err)
+	}
+	if err := e.write(msg, 0, false); err != nil {
+		e.Stats.Dropped.Add(uint64(records))
+		return err
+	}
+	for _, set := range pending {
+		e.templates.sent(set.template, set.withTemplate)
+	}
+	e.Stats.Records.Add(uint64(records))
+
+	return nil
+}
+
+// Sends the pending records of a template in their own SCTP message, after
+// the template if needed
+func (e *Exporter) flushSCTPSet(set *pendingSet) error {
+	if set.withTemplate {
+		if err := e.sendTemplateSets(set.template.set); err != nil {
+			return err
+		}
+	}
+
+	data, err := ipfix.CreateDataSet(set.template.id, set.records.Bytes())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrEncoding, err)
+	}
+	msg, err := ipfix.WrapIPFIXSets(e.domainID, e.sequences.reserve(e.domainID, set.count), data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrEncoding, err)
+	}
+	if err := e.write(msg, sctpDataStream(set.template.id), true); err != nil {
+		return err
+	}
+	e.templates.sent(set.template, set.withTemplate)
+	e.Stats.Records.Add(uint64(set.count))
+	return nil
+}
+
+// Sends the records which reached the maximum latency
+func (e *Exporter) flushOnTimer() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.flush(); err != nil && !errors.Is(err, errExporterBackoff) {
+		log.Printf("failed to send pending records to %s: %v", e.addr, err)
+	}
+}
@@ -0,0 +1,131 @@
+package export
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+)
+
+// Exports the traces through a UDP exporter and returns the received messages
+func exportBatched(t *testing.T, config Config, traces []ioam.IoamTrace) [][]byte {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	e, err := NewExporter(pc.LocalAddr().String(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, trace := range traces {
+		if err := e.Export(trace); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e.Close()
+
+	var msgs [][]byte
+	for {
+		buf := make([]byte, 65535)
+		pc.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			return msgs
+		}
+		msgs = append(msgs, buf[:n])
+	}
+}
+
+func TestBatchingRespectsMTU(t *testing.T) {
+	const mtu = 512
+
+	node := ioam.IoamNode{NodeId: 1, NodeIdWide: 2}
+	var traces []ioam.IoamTrace
+	for range 50 {
+		traces = append(traces, ioam.IoamTrace{
+			TraceType: ioam.TRACE_TYPE_BIT0_MASK | ioam.TRACE_TYPE_BIT8_MASK | ioam.TRACE_TYPE_BIT9_MASK | ioam.TRACE_TYPE_BIT10_MASK,
+			Hops:      []ioam.IoamNode{node, node, node},
+		})
+	}
+
+	msgs := exportBatched(t, Config{MTU: mtu, BatchLatency: time.Hour}, traces)
+	if len(msgs) < 2 {
+		t.Fatalf("got %d messages, want records spread over several messages", len(msgs))
+	}
+
+	lengths := make(map[uint16]int)
+	var records int
+	for i, msg := range msgs {
+		if len(msg) > mtu {
+			t.Errorf("message %d: %d bytes, MTU is %d", i, len(msg), mtu)
+		}
+		if got := binary.BigEndian.Uint32(msg[8:12]); got != uint32(records) {
+			t.Errorf("message %d: sequence number %d, want %d", i, got, records)
+		}
+		records += countDataRecords(t, msg, lengths)
+	}
+	if records != 150 {
+		t.Errorf("got %d records, want 150", records)
+	}
+}
+
+func TestBatchingRecordLimit(t *testing.T) {
+	traces := []ioam.IoamTrace{{TraceType: ioam.TRACE_TYPE_BIT2_MASK, Hops: make([]ioam.IoamNode, 7)}}
+
+	msgs := exportBatched(t, Config{MTU: DEFAULT_MTU, BatchRecords: 3, BatchLatency: time.Hour}, traces)
+
+	lengths := make(map[uint16]int)
+	var counts []int
+	for _, msg := range msgs {
+		counts = append(counts, countDataRecords(t, msg, lengths))
+	}
+	if len(counts) != 3 || counts[0] != 3 || counts[1] != 3 || counts[2] != 1 {
+		t.Errorf("records per message %v, want [3 3 1]", counts)
+	}
+}
+
+func TestFlushFailureDropsEverySet(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	e, err := NewExporter(pc.LocalAddr().String(), Config{MTU: DEFAULT_MTU, BatchLatency: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	// Records of two templates, flushed one set per message as on SCTP once
+	// the session is open
+	for i, trace := range []ioam.IoamTrace{
+		{TraceType: ioam.TRACE_TYPE_BIT0_MASK, Hops: make([]ioam.IoamNode, 2)},
+		{TraceType: ioam.TRACE_TYPE_BIT2_MASK, Hops: make([]ioam.IoamNode, 3)},
+	} {
+		if err := e.Export(trace); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			e.mu.Lock()
+			e.transport = TRANSPORT_SCTP
+			e.mu.Unlock()
+		}
+	}
+
+	e.mu.Lock()
+	e.conn.Close()
+	err = e.flush()
+	e.mu.Unlock()
+	if err == nil {
+		t.Fatal("flush on a closed session succeeded")
+	}
+	if got := e.Stats.Dropped.Load(); got != 5 {
+		t.Errorf("%d dropped records, want 5", got)
+	}
+}
@@ -0,0 +1,99 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync/atomic"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+)
+
+var errNoCollectorAvailable = errors.New("no collector available")
+
+// Collectors receiving the exported traces, according to the collector mode:
+//   - mirror: every collector receives every trace;
+//   - failover: traces go to the first available collector in the list;
+//   - hash: each trace goes to one collector, chosen from a hash of its IOAM
+//     namespace and node ID, or the next available one.
+type CollectorSet struct {
+	mode      string
+	Exporters []*Exporter // one per collector, in the given order
+
+	Unavailable atomic.Uint64 // traces not exported because no collector was available
+}
+
+// Creates one exporter per collector
+func NewCollectorSet(collectors []string, mode string, config Config) (*CollectorSet, error) {
+	switch mode {
+	case COLLECTOR_MODE_MIRROR, COLLECTOR_MODE_FAILOVER, COLLECTOR_MODE_HASH:
+	default:
+		return nil, fmt.Errorf("unknown collector mode %q", mode)
+	}
+
+	set := &CollectorSet{mode: mode}
+	for _, collector := range collectors {
+		e, err := NewExporter(collector, config)
+		if err != nil {
+			return nil, fmt.Errorf("collector %s: %v", collector, err)
+		}
+		set.Exporters = append(set.Exporters, e)
+	}
+
+	return set, nil
+}
+
+// Exports a trace to the collector(s) selected by the mode
+func (c *CollectorSet) Export(trace ioam.IoamTrace) error {
+	switch c.mode {
+	case COLLECTOR_MODE_MIRROR:
+		var errs []error
+		for _, e := range c.Exporters {
+			errs = append(errs, e.Export(trace))
+		}
+		return errors.Join(errs...)
+
+	case COLLECTOR_MODE_HASH:
+		return c.exportFrom(int(traceHash(trace)%uint32(len(c.Exporters))), trace)
+
+	default:
+		return c.exportFrom(0, trace)
+	}
+}
+
+// Exports the trace to the first available collector, starting at index first
+func (c *CollectorSet) exportFrom(first int, trace ioam.IoamTrace) error {
+	for i := range c.Exporters {
+		e := c.Exporters[(first+i)%len(c.Exporters)]
+		if !e.available() {
+			continue
+		}
+
+		err := e.Export(trace)
+		if err == nil || errors.Is(err, ErrEncoding) {
+			// Encoding errors would be the same with any collector
+			return err
+		}
+	}
+
+	c.Unavailable.Add(1)
+	return errNoCollectorAvailable
+}
+
+// Sends the pending records and closes every exporter
+func (c *CollectorSet) Close() {
+	for _, e := range c.Exporters {
+		e.Close()
+	}
+}
+
+// Hash of the IOAM namespace and node ID of the first hop of a trace
+func traceHash(trace ioam.IoamTrace) uint32 {
+	var node ioam.IoamNode
+	if len(trace.Hops) > 0 {
+		node = trace.Hops[0]
+	}
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d/%d/%d", trace.Namespace, node.NodeId, node.NodeIdWide)
+	return h.Sum32()
+}
@@ -0,0 +1,96 @@
+package export
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+)
+
+// Number of UDP messages received by the listener within a short delay
+func receivedMessages(pc net.PacketConn) int {
+	buf := make([]byte, 65535)
+	count := 0
+	for {
+		pc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		if _, _, err := pc.ReadFrom(buf); err != nil {
+			return count
+		}
+		count++
+	}
+}
+
+func TestCollectorFailover(t *testing.T) {
+	backup, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+
+	// Nothing listens on the primary TCP port
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := "tcp://" + ln.Addr().String()
+	ln.Close()
+
+	set, err := NewCollectorSet([]string{primary, backup.LocalAddr().String()}, COLLECTOR_MODE_FAILOVER, Config{MTU: DEFAULT_MTU})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer set.Close()
+
+	trace := ioam.IoamTrace{TraceType: ioam.TRACE_TYPE_BIT0_MASK, Hops: []ioam.IoamNode{{NodeId: 1}}}
+	for range 3 {
+		if err := set.Export(trace); err != nil {
+			t.Fatalf("export: %v", err)
+		}
+	}
+
+	if got := receivedMessages(backup); got != 3 {
+		t.Errorf("backup received %d messages, want 3", got)
+	}
+	if got := set.Exporters[0].State(); got != "down" {
+		t.Errorf("primary state %s, want down", got)
+	}
+	if got := set.Exporters[1].State(); got != "up" {
+		t.Errorf("backup state %s, want up", got)
+	}
+}
+
+func TestCollectorHash(t *testing.T) {
+	var listeners []net.PacketConn
+	var addrs []string
+	for range 2 {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pc.Close()
+		listeners = append(listeners, pc)
+		addrs = append(addrs, pc.LocalAddr().String())
+	}
+
+	set, err := NewCollectorSet(addrs, COLLECTOR_MODE_HASH, Config{MTU: DEFAULT_MTU})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer set.Close()
+
+	expected := make([]int, len(addrs))
+	for id := range uint32(20) {
+		trace := ioam.IoamTrace{TraceType: ioam.TRACE_TYPE_BIT0_MASK, Namespace: 1, Hops: []ioam.IoamNode{{NodeId: id}}}
+		expected[traceHash(trace)%uint32(len(addrs))]++
+		if err := set.Export(trace); err != nil {
+			t.Fatalf("export: %v", err)
+		}
+	}
+
+	for i, pc := range listeners {
+		if got := receivedMessages(pc); got != expected[i] {
+			t.Errorf("collector %d received %d messages, want %d", i, got, expected[i])
+		}
+	}
+}
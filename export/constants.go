@@ -0,0 +1,41 @@
+package export
+
+import "time"
+
+const (
+	DEFAULT_RESOLVE_INTERVAL = 5 * time.Minute
+	EXPORTER_BACKOFF_MIN     = 100 * time.Millisecond
+	EXPORTER_BACKOFF_MAX     = 30 * time.Second
+
+	EXPORTER_DIAL_TIMEOUT      = 5 * time.Second
+	EXPORTER_HANDSHAKE_TIMEOUT = 10 * time.Second
+
+	DEFAULT_TEMPLATE_REFRESH         = 30 * time.Second // UDP, RFC 7011 section 8.4
+	DEFAULT_TEMPLATE_REFRESH_PACKETS = 1000             // UDP, RFC 7011 section 8.4
+	DEFAULT_TEMPLATE_TIMEOUT         = 10 * time.Minute
+	TEMPLATE_EXPIRY_CHECK            = 1 * time.Second
+
+	DEFAULT_MTU           = 1400 // fits in an Ethernet frame over UDP and IPv6
+	DEFAULT_BATCH_RECORDS = 0    // no limit
+	DEFAULT_BATCH_LATENCY = 100 * time.Millisecond
+
+	COLLECTOR_STATE_IDLE = 0 // no session opened yet
+	COLLECTOR_STATE_UP   = 1
+	COLLECTOR_STATE_DOWN = 2
+
+	SCTP_STREAMS  = 8                      // outbound streams requested per association
+	SCTP_DATA_TTL = 500 * time.Millisecond // lifetime of data sets sent with partial reliability
+
+	ENCODING_FLAT  = "flat"  // one data record per hop
+	ENCODING_TRACE = "trace" // one data record per trace, hops in a subTemplateList
+
+	COLLECTOR_MODE_MIRROR   = "mirror"   // every collector receives every trace
+	COLLECTOR_MODE_FAILOVER = "failover" // the first available collector receives the traces
+	COLLECTOR_MODE_HASH     = "hash"     // traces are spread over the collectors by namespace and node ID
+
+	TRANSPORT_UDP  = "udp"
+	TRANSPORT_TCP  = "tcp"
+	TRANSPORT_SCTP = "sctp"
+	TRANSPORT_TLS  = "tls"  // TLS over TCP
+	TRANSPORT_DTLS = "dtls" // DTLS over UDP
+)
@@ -0,0 +1,490 @@
+// Package export sends IOAM traces encoded in IPFIX to collectors over UDP,
+// TCP, SCTP, TLS or DTLS, batching the records and managing the templates of
+// every transport session
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/Advanced-Observability/ioam-exporter/ipfix"
+	"github.com/pion/dtls/v3"
+)
+
+var errExporterBackoff = errors.New("collector unreachable, waiting before reconnecting")
+
+// Error wrapped by the exporters when a trace cannot be encoded, which would
+// fail with any collector
+var ErrEncoding = errors.New("ipfix encoding failed")
+
+// Counters of an exporter, readable while the exporter is in use
+type Stats struct {
+	Sent       atomic.Uint64 // messages written to the collector
+	Records    atomic.Uint64 // data records written to the collector
+	Bytes      atomic.Uint64 // bytes written to the collector
+	SendErrors atomic.Uint64 // failed writes
+	DialErrors atomic.Uint64 // failed resolutions or connection attempts
+	Dropped    atomic.Uint64 // data records discarded while waiting to reconnect or because their message could not be sent
+	Reconnects atomic.Uint64 // transport sessions opened after the first one
+	state      atomic.Int32  // one of the COLLECTOR_STATE_* values
+}
+
+// Settings of the exporters
+type Config struct {
+	DomainID               uint32          // observation domain of the exported records
+	ResolveInterval        time.Duration   // 0 disables DNS re-resolution
+	Creds                  *TLSCredentials // required for TLS and DTLS
+	TemplateRefresh        time.Duration   // UDP and DTLS template refresh interval
+	TemplateRefreshPackets uint64          // UDP and DTLS template refresh packet count
+	TemplateTimeout        time.Duration   // unused templates expire after this delay
+	Encoding               string          // ENCODING_FLAT (default) or ENCODING_TRACE
+	MTU                    int             // maximum size of a message, up to IPFIX_MAX_MESSAGE_LEN
+	BatchRecords           int             // flush after this number of records, 0 for no limit
+	BatchLatency           time.Duration   // flush records pending for this long, 0 to flush after every export
+}
+
+// Long-lived transport session towards one collector. The collector name is
+// re-resolved periodically and the session is re-established with an
+// exponential backoff after an error. Records are batched into messages of at
+// most mtu bytes.
+type Exporter struct {
+	mu sync.Mutex // guards everything below but the stats
+
+	transport       string // one of the TRANSPORT_* schemes
+	addr            string // host:port
+	resolveInterval time.Duration
+	creds           *TLSCredentials // TLS and DTLS only
+	credsGeneration uint64          // credentials generation used by the current session
+
+	conn        io.WriteCloser
+	remote      netip.AddrPort // resolved address the session is bound to
+	resolvedAt  time.Time
+	connected   bool // at least one session was opened
+	backoff     time.Duration
+	nextAttempt time.Time
+
+	encoding      string
+	domainID      uint32
+	sequences     *sequenceCounters
+	templates     *templateManager
+	expiryCheckAt time.Time
+
+	mtu            int
+	batchRecords   int
+	batchLatency   time.Duration
+	pending        []*pendingSet
+	pendingSize    int // size of the message holding the pending records
+	pendingRecords int
+	flushTimer     *time.Timer
+
+	Stats Stats
+}
+
+// Creates an exporter for the given collector, either host:port (UDP) or a
+// URL such as tcp://host:port. No connection is made until the first export.
+func NewExporter(collector string, config Config) (*Exporter, error) {
+	transport, addr, err := parseCollector(collector)
+	if err != nil {
+		return nil, err
+	}
+	if config.Encoding == "" {
+		config.Encoding = ENCODING_FLAT
+	} else if config.Encoding != ENCODING_FLAT && config.Encoding != ENCODING_TRACE {
+		return nil, fmt.Errorf("unknown encoding %q", config.Encoding)
+	}
+	if (transport == TRANSPORT_TLS || transport == TRANSPORT_DTLS) && config.Creds == nil {
+		return nil, fmt.Errorf("%s transport requires TLS credentials", transport)
+	}
+	if config.MTU < ipfix.IPFIX_MIN_MTU || config.MTU > ipfix.IPFIX_MAX_MESSAGE_LEN {
+		return nil, fmt.Errorf("MTU must be between %d and %d bytes", ipfix.IPFIX_MIN_MTU, ipfix.IPFIX_MAX_MESSAGE_LEN)
+	}
+
+	// Sessions without TLS ignore the credentials and their reloads
+	var creds *TLSCredentials
+	if transport == TRANSPORT_TLS || transport == TRANSPORT_DTLS {
+		creds = config.Creds
+	}
+
+	return &Exporter{
+		transport:       transport,
+		addr:            addr,
+		resolveInterval: config.ResolveInterval,
+		creds:           creds,
+		domainID:        config.DomainID,
+		encoding:        config.Encoding,
+		sequences:       newSequenceCounters(),
+		templates:       newTemplateManager(config.TemplateRefresh, config.TemplateRefreshPackets, config.TemplateTimeout),
+		mtu:             config.MTU,
+		batchRecords:    config.BatchRecords,
+		batchLatency:    config.BatchLatency,
+	}, nil
+}
+
+// Whether the given collector is reached over TLS or DTLS
+func UsesTLS(collector string) bool {
+	transport, _, err := parseCollector(collector)
+	return err == nil && (transport == TRANSPORT_TLS || transport == TRANSPORT_DTLS)
+}
+
+// Splits a collector specification into its transport and address
+func parseCollector(collector string) (string, string, error) {
+	transport, addr := TRANSPORT_UDP, collector
+
+	if strings.Contains(collector, "://") {
+		u, err := url.Parse(collector)
+		if err != nil {
+			return "", "", err
+		}
+		transport, addr = u.Scheme, u.Host
+	}
+
+	switch transport {
+	case TRANSPORT_UDP, TRANSPORT_TCP, TRANSPORT_SCTP, TRANSPORT_TLS, TRANSPORT_DTLS:
+	default:
+		return "", "", fmt.Errorf("unsupported collector transport %q", transport)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return "", "", fmt.Errorf("invalid collector address %q: %v", addr, err)
+	}
+
+	return transport, addr, nil
+}
+
+// Encodes the given trace and queues it for the collector, (re)connecting
+// if needed. The pending records are sent when the MTU or record limit is
+// reached, when the latency timer fires, or immediately if batching is
+// disabled.
+func (e *Exporter) Export(trace ioam.IoamTrace) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.connect(); err != nil {
+		if errors.Is(err, errExporterBackoff) {
+			e.Stats.Dropped.Add(uint64(e.recordCount(trace)))
+		}
+		return err
+	}
+	if err := e.expireTemplates(); err != nil {
+		return err
+	}
+
+	// Options without node data have no hops to list, their record is the
+	// same in both encodings
+	key := ipfix.TemplateKeyOf(trace)
+	key.Trace = e.encoding == ENCODING_TRACE && !trace.OptionRecord()
+	t, err := e.templates.lookup(key)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrEncoding, err)
+	}
+
+	if key.Trace {
+		// Traces of unknown receive time are observed at the export stage
+		var record bytes.Buffer
+		ipfix.EncodeIoamTrace(&record, trace, t.subID, time.Now())
+		if err := e.addRecord(t, record.Bytes()); err != nil {
+			return err
+		}
+	} else {
+		for _, record := range ipfix.IoamRecords(trace) {
+			if err := e.addRecord(t, record); err != nil {
+				return err
+			}
+		}
+	}
+
+	if e.batchLatency <= 0 {
+		return e.flush()
+	}
+	if e.pendingRecords > 0 && e.flushTimer == nil {
+		e.flushTimer = time.AfterFunc(e.batchLatency, e.flushOnTimer)
+	}
+
+	return nil
+}
+
+// Sends a message holding only template sets (on stream 0 for SCTP)
+func (e *Exporter) sendTemplateSets(sets ...[]byte) error {
+	msg, err := ipfix.WrapIPFIXSets(e.domainID, e.sequences.current(e.domainID), sets...)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrEncoding, err)
+	}
+	return e.write(msg, 0, false)
+}
+
+// Forgets unused templates, withdrawing them on reliable transports
+func (e *Exporter) expireTemplates() error {
+	if time.Now().Before(e.expiryCheckAt) {
+		return nil
+	}
+	e.expiryCheckAt = time.Now().Add(TEMPLATE_EXPIRY_CHECK)
+
+	expired := e.templates.expire()
+	if len(expired) == 0 || !e.reliable() {
+		// Template withdrawals are not sent over UDP (RFC 7011 section 8.4)
+		return nil
+	}
+
+	var sets [][]byte
+	for _, t := range expired {
+		for _, id := range []uint16{t.id, t.subID} {
+			if id == 0 {
+				continue
+			}
+			withdrawal, err := ipfix.CreateTemplateWithdrawalSet(id)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrEncoding, err)
+			}
+			sets = append(sets, withdrawal)
+		}
+	}
+	return e.sendTemplateSets(sets...)
+}
+
+// Whether a session is open or may be opened now, i.e. not waiting to reconnect
+func (e *Exporter) available() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.conn != nil || !time.Now().Before(e.nextAttempt)
+}
+
+// Collector URL
+func (e *Exporter) Name() string {
+	return e.transport + "://" + e.addr
+}
+
+// Health of the collector, as seen by the exporter
+func (e *Exporter) State() string {
+	switch e.Stats.state.Load() {
+	case COLLECTOR_STATE_UP:
+		return "up"
+	case COLLECTOR_STATE_DOWN:
+		return "down"
+	default:
+		return "idle"
+	}
+}
+
+// Whether the transport delivers messages reliably and in order
+func (e *Exporter) reliable() bool {
+	return e.transport == TRANSPORT_TCP || e.transport == TRANSPORT_TLS || e.transport == TRANSPORT_SCTP
+}
+
+// Shuts the exporter down, sending the pending records and withdrawing all
+// templates on reliable transports
+func (e *Exporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.flush(); err != nil {
+		log.Printf("failed to send pending records to %s: %v", e.addr, err)
+	}
+
+	if e.conn != nil && e.reliable() && e.templates.anyAnnounced() {
+		// Withdrawing template ID 2 withdraws all the data templates
+		withdrawal, err := ipfix.CreateTemplateWithdrawalSet(2)
+		if err == nil {
+			err = e.sendTemplateSets(withdrawal)
+		}
+		if err != nil {
+			log.Printf("failed to withdraw templates from %s: %v", e.addr, err)
+		}
+	}
+	return e.disconnect()
+}
+
+// Closes the current transport session, if any
+func (e *Exporter) disconnect() error {
+	if e.conn == nil {
+		return nil
+	}
+	err := e.conn.Close()
+	e.conn = nil
+	return err
+}
+
+// Makes sure a transport session is open, unless waiting to reconnect
+func (e *Exporter) connect() error {
+	if e.conn != nil && e.resolveInterval > 0 && time.Since(e.resolvedAt) >= e.resolveInterval {
+		e.checkResolution()
+	}
+	if e.conn != nil && e.creds != nil && e.creds.generation.Load() != e.credsGeneration {
+		// New certificates are only used after a new handshake
+		log.Printf("reconnecting to collector %s with new TLS credentials", e.addr)
+		if err := e.flush(); err != nil {
+			log.Printf("failed to send pending records to %s: %v", e.addr, err)
+		}
+		if err := e.disconnect(); err != nil {
+			log.Printf("failed to close the session with %s: %v", e.addr, err)
+		}
+	}
+	if e.conn != nil {
+		return nil
+	}
+
+	if time.Now().Before(e.nextAttempt) {
+		return errExporterBackoff
+	}
+	if err := e.dial(); err != nil {
+		e.Stats.DialErrors.Add(1)
+		e.scheduleReconnect()
+		log.Printf("failed to connect to collector %s: %v", e.addr, err)
+		return err
+	}
+
+	return nil
+}
+
+// Number of data records of a trace in the encoding of the exporter
+func (e *Exporter) recordCount(trace ioam.IoamTrace) int {
+	if trace.OptionRecord() || e.encoding == ENCODING_TRACE {
+		return 1
+	}
+	return len(trace.Hops)
+}
+
+// Writes a message on the current session. The stream and partial
+// reliability are only meaningful for SCTP.
+func (e *Exporter) write(msg []byte, stream uint16, partial bool) error {
+	var err error
+	if sc, ok := e.conn.(*sctpConn); ok && partial {
+		_, err = sc.writeStream(msg, stream, SCTP_DATA_TTL)
+	} else if ok {
+		_, err = sc.writeStream(msg, stream, 0)
+	} else {
+		_, err = e.conn.Write(msg)
+	}
+
+	if err != nil {
+		e.Stats.SendErrors.Add(1)
+		e.disconnect()
+		e.scheduleReconnect()
+		log.Printf("failed to send IPFIX message to %s: %v", e.addr, err)
+		return err
+	}
+
+	e.Stats.Sent.Add(1)
+	e.Stats.Bytes.Add(uint64(len(msg)))
+	return nil
+}
+
+// Resolves the collector address and opens a new transport session
+func (e *Exporter) dial() error {
+	remote, err := resolveCollector(e.addr)
+	if err != nil {
+		return err
+	}
+
+	host, _, _ := net.SplitHostPort(e.addr)
+	if e.creds != nil {
+		e.credsGeneration = e.creds.generation.Load()
+	}
+
+	switch e.transport {
+	case TRANSPORT_TCP:
+		dialer := &net.Dialer{Timeout: EXPORTER_DIAL_TIMEOUT}
+		e.conn, err = dialer.Dial("tcp", remote.String())
+	case TRANSPORT_SCTP:
+		e.conn, err = dialSCTP(remote, SCTP_STREAMS, EXPORTER_DIAL_TIMEOUT)
+	case TRANSPORT_TLS:
+		dialer := &net.Dialer{Timeout: EXPORTER_HANDSHAKE_TIMEOUT}
+		e.conn, err = tls.DialWithDialer(dialer, "tcp", remote.String(), e.creds.tlsConfig(host))
+	case TRANSPORT_DTLS:
+		e.conn, err = dialDTLS(remote, e.creds.dtlsConfig(host))
+	default:
+		e.conn, err = net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(remote))
+	}
+	if err != nil {
+		e.conn = nil
+		return err
+	}
+
+	// Templates and sequence numbers are scoped to the transport session
+	e.templates.reset()
+	e.sequences.reset()
+
+	e.remote = remote
+	e.resolvedAt = time.Now()
+	e.backoff = 0
+	e.Stats.state.Store(COLLECTOR_STATE_UP)
+	if e.connected {
+		e.Stats.Reconnects.Add(1)
+	}
+	e.connected = true
+
+	return nil
+}
+
+// Re-resolves the collector name and drops the session if the address changed
+func (e *Exporter) checkResolution() {
+	e.resolvedAt = time.Now()
+
+	remote, err := resolveCollector(e.addr)
+	if err != nil {
+		// Keep using the current session until the name resolves again
+		log.Printf("failed to resolve collector %s: %v", e.addr, err)
+		return
+	}
+	if remote != e.remote {
+		log.Printf("collector %s moved from %s to %s", e.addr, e.remote, remote)
+		e.flush()
+		e.disconnect()
+	}
+}
+
+// Doubles the delay before the next connection attempt
+func (e *Exporter) scheduleReconnect() {
+	e.Stats.state.Store(COLLECTOR_STATE_DOWN)
+
+	if e.backoff == 0 {
+		e.backoff = EXPORTER_BACKOFF_MIN
+	} else {
+		e.backoff = min(2*e.backoff, EXPORTER_BACKOFF_MAX)
+	}
+	e.nextAttempt = time.Now().Add(e.backoff)
+}
+
+// Opens a DTLS session and completes the handshake
+func dialDTLS(remote netip.AddrPort, config *dtls.Config) (*dtls.Conn, error) {
+	conn, err := dtls.Dial("udp", net.UDPAddrFromAddrPort(remote), config)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), EXPORTER_HANDSHAKE_TIMEOUT)
+	defer cancel()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// Resolves a host:port collector address
+func resolveCollector(addr string) (netip.AddrPort, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	return raddr.AddrPort(), nil
+}
+
+// SCTP stream carrying the data sets of the given template (stream 0 is
+// reserved for templates)
+func sctpDataStream(templateID uint16) uint16 {
+	return 1 + templateID%(SCTP_STREAMS-1)
+}
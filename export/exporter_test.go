@@ -0,0 +1,323 @@
+package export
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+)
+
+// Trace exported as a single flat record
+var testExportTrace = ioam.IoamTrace{TraceType: ioam.TRACE_TYPE_BIT0_MASK, Hops: []ioam.IoamNode{{NodeId: 1}}}
+
+// Splits an IPFIX stream into messages using their length field, until the
+// end of the stream
+func readStreamMessages(t *testing.T, r io.Reader) [][]byte {
+	t.Helper()
+
+	var msgs [][]byte
+	for {
+		header := make([]byte, 16)
+		if _, err := io.ReadFull(r, header); errors.Is(err, io.EOF) {
+			return msgs
+		} else if err != nil {
+			t.Fatalf("message %d: %v", len(msgs), err)
+		}
+		msg := make([]byte, binary.BigEndian.Uint16(header[2:4]))
+		copy(msg, header)
+		if _, err := io.ReadFull(r, msg[16:]); err != nil {
+			t.Fatalf("message %d: %v", len(msgs), err)
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+// Returns the set IDs of a message
+func setIDs(msg []byte) []uint16 {
+	var ids []uint16
+	for offset := 16; offset+4 <= len(msg); {
+		ids = append(ids, binary.BigEndian.Uint16(msg[offset:offset+2]))
+		offset += int(binary.BigEndian.Uint16(msg[offset+2 : offset+4]))
+	}
+	return ids
+}
+
+// Accepts the TCP connections of a listener
+func acceptAll(ln net.Listener) chan net.Conn {
+	conns := make(chan net.Conn, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				close(conns)
+				return
+			}
+			conns <- conn
+		}
+	}()
+	return conns
+}
+
+// Address on which nothing listens
+func closedPort(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestTCPStreamFraming(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conns := acceptAll(ln)
+
+	e, err := NewExporter("tcp://"+ln.Addr().String(), Config{MTU: DEFAULT_MTU})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		if err := e.Export(testExportTrace); err != nil {
+			t.Fatalf("export %d: %v", i, err)
+		}
+	}
+	e.Close()
+
+	conn := <-conns
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	msgs := readStreamMessages(t, conn)
+
+	// Five data messages, the first one with the template, then the withdrawal
+	if len(msgs) != 6 {
+		t.Fatalf("got %d messages, want 6", len(msgs))
+	}
+	lengths := make(map[uint16]int)
+	for i, msg := range msgs[:5] {
+		if got := binary.BigEndian.Uint32(msg[8:12]); got != uint32(i) {
+			t.Errorf("message %d: sequence number %d, want %d", i, got, i)
+		}
+		ids := setIDs(msg)
+		if withTemplate := ids[0] == 2; withTemplate != (i == 0) {
+			t.Errorf("message %d: sets %v", i, ids)
+		}
+		if records := countDataRecords(t, msg, lengths); records != 1 {
+			t.Errorf("message %d: %d records, want 1", i, records)
+		}
+	}
+	if ids := setIDs(msgs[5]); len(ids) != 1 || ids[0] != 2 {
+		t.Errorf("withdrawal message: sets %v", ids)
+	}
+}
+
+func TestTCPTemplateResendAfterReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conns := acceptAll(ln)
+
+	e, err := NewExporter("tcp://"+ln.Addr().String(), Config{MTU: DEFAULT_MTU})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	if err := e.Export(testExportTrace); err != nil {
+		t.Fatal(err)
+	}
+	// The collector drops the session: exports fail until the exporter
+	// notices it, then wait for the backoff delay
+	(<-conns).Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for e.Stats.Reconnects.Load() == 0 && time.Now().Before(deadline) {
+		e.Export(testExportTrace)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if e.Stats.SendErrors.Load() == 0 || e.Stats.Reconnects.Load() != 1 {
+		t.Fatalf("%d send errors, %d reconnects", e.Stats.SendErrors.Load(), e.Stats.Reconnects.Load())
+	}
+
+	conn := <-conns
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	header := make([]byte, 20)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatal(err)
+	}
+	// Templates and sequence numbers start over in the new session
+	if got := binary.BigEndian.Uint32(header[8:12]); got != 0 {
+		t.Errorf("sequence number %d, want 0", got)
+	}
+	if got := binary.BigEndian.Uint16(header[16:18]); got != 2 {
+		t.Errorf("first set %d, want the template set", got)
+	}
+}
+
+func TestSCTPFailover(t *testing.T) {
+	backup, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+
+	// Without a listener, or without SCTP support in the kernel, the
+	// association cannot be established
+	set, err := NewCollectorSet([]string{"sctp://" + closedPort(t), backup.LocalAddr().String()}, COLLECTOR_MODE_FAILOVER, Config{MTU: DEFAULT_MTU})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer set.Close()
+
+	for range 2 {
+		if err := set.Export(testExportTrace); err != nil {
+			t.Fatalf("export: %v", err)
+		}
+	}
+
+	if got := receivedMessages(backup); got != 2 {
+		t.Errorf("backup received %d messages, want 2", got)
+	}
+	sctp := set.Exporters[0]
+	if sctp.State() != "down" || sctp.Stats.DialErrors.Load() != 1 {
+		t.Errorf("SCTP collector %s after %d connection errors", sctp.State(), sctp.Stats.DialErrors.Load())
+	}
+}
+
+func TestExporterBackoffBounds(t *testing.T) {
+	e, err := NewExporter("127.0.0.1:4739", Config{MTU: DEFAULT_MTU})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := EXPORTER_BACKOFF_MIN
+	for i := range 20 {
+		before := time.Now()
+		e.scheduleReconnect()
+		if e.backoff != want {
+			t.Fatalf("attempt %d: backoff %v, want %v", i, e.backoff, want)
+		}
+		if wait := e.nextAttempt.Sub(before); wait < want || wait > want+time.Second {
+			t.Errorf("attempt %d: next attempt in %v, want %v", i, wait, want)
+		}
+		want = min(2*want, EXPORTER_BACKOFF_MAX)
+	}
+	if e.backoff != EXPORTER_BACKOFF_MAX {
+		t.Errorf("backoff %v, want %v", e.backoff, EXPORTER_BACKOFF_MAX)
+	}
+}
+
+func TestExporterReconnect(t *testing.T) {
+	addr := closedPort(t)
+	e, err := NewExporter("tcp://"+addr, Config{MTU: DEFAULT_MTU})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	if err := e.Export(testExportTrace); err == nil {
+		t.Fatal("export without collector succeeded")
+	}
+	// Traces are dropped until the next attempt
+	if err := e.Export(testExportTrace); !errors.Is(err, errExporterBackoff) {
+		t.Fatalf("export while waiting: got %v", err)
+	}
+	if e.State() != "down" || e.Stats.DialErrors.Load() != 1 || e.Stats.Dropped.Load() != 1 {
+		t.Fatalf("%s after %d connection errors and %d drops", e.State(), e.Stats.DialErrors.Load(), e.Stats.Dropped.Load())
+	}
+
+	// The collector comes back
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conns := acceptAll(ln)
+	time.Sleep(EXPORTER_BACKOFF_MIN)
+	if err := e.Export(testExportTrace); err != nil {
+		t.Fatalf("export after the backoff: %v", err)
+	}
+	if e.State() != "up" || e.Stats.Reconnects.Load() != 0 || e.backoff != 0 {
+		t.Errorf("%s after %d reconnects, backoff %v", e.State(), e.Stats.Reconnects.Load(), e.backoff)
+	}
+
+	// Sessions opened after a loss are reconnects
+	(<-conns).Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for e.Stats.Reconnects.Load() == 0 && time.Now().Before(deadline) {
+		e.Export(testExportTrace)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if e.State() != "up" || e.Stats.Reconnects.Load() != 1 {
+		t.Errorf("%s after %d reconnects, want up after 1", e.State(), e.Stats.Reconnects.Load())
+	}
+}
+
+func TestExporterCredentialsChangeFlushFailure(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	e, err := NewExporter(pc.LocalAddr().String(), Config{MTU: DEFAULT_MTU, BatchLatency: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	trace := ioam.IoamTrace{TraceType: ioam.TRACE_TYPE_BIT0_MASK, Hops: make([]ioam.IoamNode, 3)}
+	if err := e.Export(trace); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pending records cannot be sent on the old session when the
+	// credentials change
+	e.mu.Lock()
+	e.conn.Close()
+	e.creds = &TLSCredentials{}
+	e.creds.generation.Add(1)
+	e.mu.Unlock()
+	// The failed write delays the new session, the next trace is dropped too
+	if err := e.Export(testExportTrace); !errors.Is(err, errExporterBackoff) {
+		t.Fatalf("export after the failed flush: got %v", err)
+	}
+	if got := e.Stats.Dropped.Load(); got != 4 {
+		t.Errorf("%d dropped records, want 4", got)
+	}
+}
+
+func TestExporterCredentialsOnlyForTLS(t *testing.T) {
+	for _, tt := range []struct {
+		collector string
+		tls       bool
+	}{
+		{"127.0.0.1:4739", false},
+		{"tcp://127.0.0.1:4739", false},
+		{"sctp://127.0.0.1:4739", false},
+		{"tls://127.0.0.1:4739", true},
+		{"dtls://127.0.0.1:4739", true},
+	} {
+		if got := UsesTLS(tt.collector); got != tt.tls {
+			t.Errorf("%s: uses TLS %v, want %v", tt.collector, got, tt.tls)
+		}
+		e, err := NewExporter(tt.collector, Config{MTU: DEFAULT_MTU, Creds: &TLSCredentials{}})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.collector, err)
+		}
+		if got := e.creds != nil; got != tt.tls {
+			t.Errorf("%s: credentials kept %v, want %v", tt.collector, got, tt.tls)
+		}
+		e.Close()
+	}
+}
@@ -0,0 +1,124 @@
+package export
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Linux SCTP socket API (linux/sctp.h), not provided by x/sys/unix
+const (
+	SCTP_INITMSG = 2 // socket option
+	SCTP_SNDRCV  = 1 // ancillary data type
+
+	SCTP_PR_SCTP_TTL = 0x0010 // timed partial reliability (RFC 3758)
+
+	sctpInitMsgLen    = 8
+	sctpSndRcvInfoLen = 32
+)
+
+// One-to-one SCTP association with a collector
+type sctpConn struct {
+	fd int
+}
+
+// Opens an SCTP association with the given number of outbound streams,
+// giving up if it is not established within timeout
+func dialSCTP(remote netip.AddrPort, streams uint16, timeout time.Duration) (*sctpConn, error) {
+	var family int
+	var sa unix.Sockaddr
+	if addr := remote.Addr(); addr.Is4() || addr.Is4In6() {
+		family = unix.AF_INET
+		sa = &unix.SockaddrInet4{Port: int(remote.Port()), Addr: addr.Unmap().As4()}
+	} else {
+		family = unix.AF_INET6
+		sa = &unix.SockaddrInet6{Port: int(remote.Port()), Addr: addr.As16()}
+	}
+
+	fd, err := unix.Socket(family, unix.SOCK_STREAM|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, unix.IPPROTO_SCTP)
+	if err != nil {
+		return nil, err
+	}
+
+	// struct sctp_initmsg: number of outbound streams requested at association setup
+	initMsg := make([]byte, sctpInitMsgLen)
+	binary.NativeEndian.PutUint16(initMsg[0:2], streams)
+	binary.NativeEndian.PutUint16(initMsg[2:4], streams)
+	if err := unix.SetsockoptString(fd, unix.IPPROTO_SCTP, SCTP_INITMSG, string(initMsg)); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	if err := connectTimeout(fd, sa, timeout); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	return &sctpConn{fd: fd}, nil
+}
+
+// Connects a non-blocking socket within timeout, then makes it blocking again
+func connectTimeout(fd int, sa unix.Sockaddr, timeout time.Duration) error {
+	err := unix.Connect(fd, sa)
+	if errors.Is(err, unix.EINPROGRESS) {
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLOUT}}
+		var n int
+		for {
+			n, err = unix.Poll(fds, int(timeout.Milliseconds()))
+			if !errors.Is(err, unix.EINTR) {
+				break
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return unix.ETIMEDOUT
+		}
+		soErr, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_ERROR)
+		if err != nil {
+			return err
+		}
+		if soErr != 0 {
+			return unix.Errno(soErr)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	return unix.SetNonblock(fd, false)
+}
+
+// Sends a message reliably on stream 0
+func (c *sctpConn) Write(b []byte) (int, error) {
+	return c.writeStream(b, 0, 0)
+}
+
+// Sends a message on the given stream. A positive ttl enables partial
+// reliability: the message is abandoned if not delivered within ttl.
+func (c *sctpConn) writeStream(b []byte, stream uint16, ttl time.Duration) (int, error) {
+	oob := make([]byte, unix.CmsgSpace(sctpSndRcvInfoLen))
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	h.Level = unix.IPPROTO_SCTP
+	h.Type = SCTP_SNDRCV
+	h.SetLen(unix.CmsgLen(sctpSndRcvInfoLen))
+
+	// struct sctp_sndrcvinfo
+	info := oob[unix.CmsgLen(0):]
+	binary.NativeEndian.PutUint16(info[0:2], stream)
+	if ttl > 0 {
+		binary.NativeEndian.PutUint16(info[4:6], SCTP_PR_SCTP_TTL)
+		binary.NativeEndian.PutUint32(info[16:20], uint32(ttl.Milliseconds()))
+	}
+
+	return unix.SendmsgN(c.fd, b, oob, nil, 0)
+}
+
+// Shuts down the association
+func (c *sctpConn) Close() error {
+	return unix.Close(c.fd)
+}
@@ -0,0 +1,43 @@
+package export
+
+import "sync"
+
+// Per-observation-domain sequence numbers of one transport session. The
+// sequence number of a message is the number of data records previously sent
+// in its observation domain, modulo 2^32 (RFC 7011 section 3.1).
+type sequenceCounters struct {
+	mu      sync.Mutex
+	domains map[uint32]uint32
+}
+
+// Creates counters starting at 0 in every observation domain
+func newSequenceCounters() *sequenceCounters {
+	return &sequenceCounters{domains: make(map[uint32]uint32)}
+}
+
+// Returns the sequence number of a message carrying the given number of data
+// records in the domain, and accounts for these records
+func (s *sequenceCounters) reserve(domainID uint32, records int) uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq := s.domains[domainID]
+	s.domains[domainID] = seq + uint32(records)
+	return seq
+}
+
+// Returns the sequence number of a message without data records
+func (s *sequenceCounters) current(domainID uint32) uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.domains[domainID]
+}
+
+// Restarts every domain at 0, for a new transport session
+func (s *sequenceCounters) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clear(s.domains)
+}
@@ -0,0 +1,157 @@
+package export
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/Advanced-Observability/ioam-exporter/ipfix"
+)
+
+func TestSequenceCountersConcurrent(t *testing.T) {
+	const goroutines, iterations, records = 8, 1000, 3
+
+	seqs := newSequenceCounters()
+	starts := make(chan uint32, goroutines*iterations)
+
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range iterations {
+				starts <- seqs.reserve(ipfix.IPFIX_DOMAIN_ID, records)
+			}
+		}()
+	}
+	wg.Wait()
+	close(starts)
+
+	// Every message must get its own range of sequence numbers
+	seen := make(map[uint32]bool)
+	for start := range starts {
+		if start%records != 0 || seen[start] {
+			t.Fatalf("overlapping sequence number %d", start)
+		}
+		seen[start] = true
+	}
+
+	if got, want := seqs.current(ipfix.IPFIX_DOMAIN_ID), uint32(goroutines*iterations*records); got != want {
+		t.Errorf("current() = %d, want %d", got, want)
+	}
+	if got := seqs.current(ipfix.IPFIX_DOMAIN_ID + 1); got != 0 {
+		t.Errorf("other domain current() = %d, want 0", got)
+	}
+
+	seqs.reset()
+	if got := seqs.current(ipfix.IPFIX_DOMAIN_ID); got != 0 {
+		t.Errorf("current() after reset = %d, want 0", got)
+	}
+}
+
+func TestExporterSequenceContinuity(t *testing.T) {
+	const domainID = 42
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	e, err := NewExporter(pc.LocalAddr().String(), Config{DomainID: domainID, TemplateRefreshPackets: 3, MTU: DEFAULT_MTU})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	pto := func(hops int) ioam.IoamTrace {
+		node := ioam.IoamNode{NodeId: 1, IngressId: 2, EgressId: 3}
+		trace := ioam.IoamTrace{TraceType: ioam.TRACE_TYPE_BIT0_MASK | ioam.TRACE_TYPE_BIT1_MASK}
+		for range hops {
+			trace.Hops = append(trace.Hops, node)
+		}
+		return trace
+	}
+	dex := ioam.IoamTrace{
+		OptionType: ioam.IOAM6_OPTION_TYPE_DEX, TraceType: ioam.TRACE_TYPE_BIT2_MASK | ioam.TRACE_TYPE_BIT3_MASK,
+		DexFlowID: 7, HasDexFlowID: true, Hops: []ioam.IoamNode{{}},
+	}
+	traces := []ioam.IoamTrace{pto(3), dex, pto(1), pto(5), dex, dex, pto(2)}
+
+	lengths := make(map[uint16]int) // record length per template ID
+	var expected uint32
+	buf := make([]byte, 65535)
+
+	for i, trace := range traces {
+		if err := e.Export(trace); err != nil {
+			t.Fatalf("export %d: %v", i, err)
+		}
+
+		pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		msg := buf[:n]
+
+		if got := binary.BigEndian.Uint32(msg[12:16]); got != domainID {
+			t.Errorf("message %d: domain %d, want %d", i, got, domainID)
+		}
+		if got := binary.BigEndian.Uint32(msg[8:12]); got != expected {
+			t.Errorf("message %d: sequence number %d, want %d", i, got, expected)
+		}
+		records := countDataRecords(t, msg, lengths)
+		if records != len(trace.Hops) {
+			t.Errorf("message %d: %d data records, want %d", i, records, len(trace.Hops))
+		}
+		expected += uint32(records)
+	}
+}
+
+// Counts the data records of a message made of fixed-length records, learning
+// the templates it carries
+func countDataRecords(t *testing.T, msg []byte, lengths map[uint16]int) int {
+	t.Helper()
+
+	if got := int(binary.BigEndian.Uint16(msg[2:4])); got != len(msg) {
+		t.Fatalf("message length %d, received %d bytes", got, len(msg))
+	}
+
+	records := 0
+	for offset := 16; offset < len(msg); {
+		setID := binary.BigEndian.Uint16(msg[offset : offset+2])
+		setLen := int(binary.BigEndian.Uint16(msg[offset+2 : offset+4]))
+		body := msg[offset+4 : offset+setLen]
+
+		switch {
+		case setID == 2:
+			for len(body) > 0 {
+				id := binary.BigEndian.Uint16(body[0:2])
+				count := int(binary.BigEndian.Uint16(body[2:4]))
+				body = body[4:]
+				length := 0
+				for range count {
+					fieldID := binary.BigEndian.Uint16(body[0:2])
+					length += int(binary.BigEndian.Uint16(body[2:4]))
+					body = body[4:]
+					if fieldID&0x8000 != 0 {
+						body = body[4:]
+					}
+				}
+				lengths[id] = length
+			}
+		case setID >= 256:
+			length, ok := lengths[setID]
+			if !ok {
+				t.Fatalf("data set for unknown template %d", setID)
+			}
+			records += len(body) / length
+		}
+		offset += setLen
+	}
+
+	return records
+}
@@ -0,0 +1,172 @@
+package export
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/ipfix"
+)
+
+var errTemplateIDsExhausted = errors.New("no template ID available")
+
+// Template allocated for one record layout
+type ioamTemplate struct {
+	id       uint16
+	subID    uint16 // template of the hops of trace records, 0 otherwise
+	key      ipfix.TemplateKey
+	set      []byte // encoded template set, with the hop template if any
+	lastUsed time.Time
+
+	// Announcement state in the current transport session
+	announced   bool
+	announcedAt time.Time
+	sentSince   uint64 // messages sent since the last announcement
+}
+
+// Allocates template IDs and decides when templates must be (re)sent, see
+// RFC 7011 section 8. A templateManager belongs to a single exporter and is
+// not safe for concurrent use.
+type templateManager struct {
+	refreshInterval time.Duration // UDP only, 0 to disable
+	refreshPackets  uint64        // UDP only, 0 to disable
+	timeout         time.Duration // unused templates expire, 0 to disable
+
+	nextID    uint16
+	templates map[ipfix.TemplateKey]*ioamTemplate
+	ids       map[uint16]*ioamTemplate
+}
+
+// Creates an empty template manager
+func newTemplateManager(refreshInterval time.Duration, refreshPackets uint64, timeout time.Duration) *templateManager {
+	return &templateManager{
+		refreshInterval: refreshInterval,
+		refreshPackets:  refreshPackets,
+		timeout:         timeout,
+		nextID:          ipfix.TEMPLATE_ID,
+		templates:       make(map[ipfix.TemplateKey]*ioamTemplate),
+		ids:             make(map[uint16]*ioamTemplate),
+	}
+}
+
+// Returns the template for the given layout, allocating a new ID on first use
+func (m *templateManager) lookup(key ipfix.TemplateKey) (*ioamTemplate, error) {
+	if t, ok := m.templates[key]; ok {
+		t.lastUsed = time.Now()
+		return t, nil
+	}
+
+	t := &ioamTemplate{
+		key:      key,
+		lastUsed: time.Now(),
+	}
+
+	var err error
+	if t.id, err = m.allocateID(); err != nil {
+		return nil, err
+	}
+	m.ids[t.id] = t
+
+	if key.Trace {
+		if t.subID, err = m.allocateID(); err != nil {
+			delete(m.ids, t.id)
+			return nil, err
+		}
+		m.ids[t.subID] = t
+		t.set, err = ipfix.CreateIOAMTraceTemplateSet(t.id, t.subID, key)
+	} else {
+		t.set, _, err = ipfix.CreateIOAMTemplateSet(t.id, key)
+	}
+	if err != nil {
+		m.release(t)
+		return nil, err
+	}
+	m.templates[key] = t
+
+	return t, nil
+}
+
+// Picks the next free data template ID, cycling through the whole ID space so
+// that IDs are not reused while collectors may still remember them
+func (m *templateManager) allocateID() (uint16, error) {
+	for range 65536 - 256 {
+		id := m.nextID
+		if m.nextID == 65535 {
+			m.nextID = 256
+		} else {
+			m.nextID++
+		}
+		if _, used := m.ids[id]; !used {
+			return id, nil
+		}
+	}
+	return 0, errTemplateIDsExhausted
+}
+
+// Frees the template IDs of a template
+func (m *templateManager) release(t *ioamTemplate) {
+	delete(m.ids, t.id)
+	if t.subID != 0 {
+		delete(m.ids, t.subID)
+	}
+}
+
+// Whether the template must be sent with the next data set
+func (m *templateManager) needsAnnouncement(t *ioamTemplate, reliable bool) bool {
+	if !t.announced {
+		return true
+	}
+	if reliable {
+		return false
+	}
+	return (m.refreshInterval > 0 && time.Since(t.announcedAt) >= m.refreshInterval) ||
+		(m.refreshPackets > 0 && t.sentSince >= m.refreshPackets)
+}
+
+// Records that a message using the template was sent, with or without it
+func (m *templateManager) sent(t *ioamTemplate, withTemplate bool) {
+	if withTemplate {
+		t.announced = true
+		t.announcedAt = time.Now()
+		t.sentSince = 0
+	}
+	t.sentSince++
+}
+
+// Forgets the templates unused for longer than the timeout and returns the
+// ones that were announced in the current session
+func (m *templateManager) expire() []*ioamTemplate {
+	if m.timeout <= 0 {
+		return nil
+	}
+
+	var expired []*ioamTemplate
+	for key, t := range m.templates {
+		if time.Since(t.lastUsed) < m.timeout {
+			continue
+		}
+		delete(m.templates, key)
+		m.release(t)
+		if t.announced {
+			expired = append(expired, t)
+		}
+	}
+	return expired
+}
+
+// Marks every template as unknown to the collector, for a new session
+func (m *templateManager) reset() {
+	for _, t := range m.templates {
+		t.announced = false
+		t.sentSince = 0
+	}
+}
+
+// Whether any template was announced in the current session
+func (m *templateManager) anyAnnounced() bool {
+	for _, t := range m.templates {
+		if t.announced {
+			return true
+		}
+	}
+	return false
+}
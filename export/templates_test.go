@@ -0,0 +1,143 @@
+package export
+
+import (
+	"encoding/binary"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/Advanced-Observability/ioam-exporter/ipfix"
+)
+
+// Returns the template IDs withdrawn by a message
+func withdrawnIDs(msg []byte) []uint16 {
+	var ids []uint16
+	for offset := 16; offset+4 <= len(msg); {
+		setID := binary.BigEndian.Uint16(msg[offset : offset+2])
+		setLen := int(binary.BigEndian.Uint16(msg[offset+2 : offset+4]))
+		// A withdrawal is a template record without any field
+		if body := msg[offset+4 : offset+setLen]; setID == 2 && len(body) == 4 && binary.BigEndian.Uint16(body[2:4]) == 0 {
+			ids = append(ids, binary.BigEndian.Uint16(body[0:2]))
+		}
+		offset += setLen
+	}
+	return ids
+}
+
+func TestTemplateRefreshInterval(t *testing.T) {
+	m := newTemplateManager(50*time.Millisecond, 0, 0)
+	tpl, err := m.lookup(ipfix.TemplateKey{TraceType: ioam.TRACE_TYPE_BIT0_MASK})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.needsAnnouncement(tpl, false) || !m.needsAnnouncement(tpl, true) {
+		t.Fatal("new template not announced")
+	}
+	m.sent(tpl, true)
+	if m.needsAnnouncement(tpl, false) {
+		t.Error("template announced again before the refresh interval")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if !m.needsAnnouncement(tpl, false) {
+		t.Error("template not refreshed after the interval")
+	}
+	if m.needsAnnouncement(tpl, true) {
+		t.Error("template refreshed on a reliable transport")
+	}
+}
+
+func TestTemplateRefreshPackets(t *testing.T) {
+	m := newTemplateManager(0, 3, 0)
+	tpl, err := m.lookup(ipfix.TemplateKey{TraceType: ioam.TRACE_TYPE_BIT0_MASK})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every third message carries the template
+	var announced []bool
+	for range 7 {
+		withTemplate := m.needsAnnouncement(tpl, false)
+		announced = append(announced, withTemplate)
+		m.sent(tpl, withTemplate)
+	}
+	if want := []bool{true, false, false, true, false, false, true}; !slices.Equal(announced, want) {
+		t.Errorf("templates sent %v, want %v", announced, want)
+	}
+}
+
+func TestTemplateExpiry(t *testing.T) {
+	m := newTemplateManager(0, 0, 20*time.Millisecond)
+	used, err := m.lookup(ipfix.TemplateKey{TraceType: ioam.TRACE_TYPE_BIT0_MASK})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unused, err := m.lookup(ipfix.TemplateKey{TraceType: ioam.TRACE_TYPE_BIT1_MASK})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.sent(used, true)
+
+	if expired := m.expire(); len(expired) != 0 {
+		t.Fatalf("%d templates expired before the timeout", len(expired))
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// Only announced templates need to be withdrawn, but both are forgotten
+	expired := m.expire()
+	if len(expired) != 1 || expired[0] != used {
+		t.Fatalf("expired %v, want the announced template", expired)
+	}
+	again, err := m.lookup(used.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == used || again.id == used.id || again.id == unused.id {
+		t.Errorf("expired template ID %d reused as %d", used.id, again.id)
+	}
+}
+
+func TestTemplateWithdrawal(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conns := acceptAll(ln)
+
+	e, err := NewExporter("tcp://"+ln.Addr().String(), Config{MTU: DEFAULT_MTU, TemplateTimeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := ioam.IoamTrace{TraceType: ioam.TRACE_TYPE_BIT1_MASK, Hops: []ioam.IoamNode{{IngressId: 1}}}
+	if err := e.Export(testExportTrace); err != nil {
+		t.Fatal(err)
+	}
+	expiredID := e.templates.templates[ipfix.TemplateKeyOf(testExportTrace)].id
+
+	// The unused template is withdrawn at the next check
+	time.Sleep(30 * time.Millisecond)
+	e.expiryCheckAt = time.Time{}
+	if err := e.Export(other); err != nil {
+		t.Fatal(err)
+	}
+	e.Close()
+
+	conn := <-conns
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	msgs := readStreamMessages(t, conn)
+	if len(msgs) != 4 {
+		t.Fatalf("got %d messages, want 4", len(msgs))
+	}
+	if ids := withdrawnIDs(msgs[1]); len(ids) != 1 || ids[0] != expiredID {
+		t.Errorf("expiry withdrew templates %v, want [%d]", ids, expiredID)
+	}
+	// Withdrawing template ID 2 withdraws all the data templates
+	if ids := withdrawnIDs(msgs[3]); len(ids) != 1 || ids[0] != 2 {
+		t.Errorf("close withdrew templates %v, want [2]", ids)
+	}
+}
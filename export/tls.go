@@ -0,0 +1,124 @@
+package export
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/pion/dtls/v3"
+)
+
+// Certificates used by TLS and DTLS sessions, reloadable at runtime
+type TLSCredentials struct {
+	caFile, certFile, keyFile string
+	serverName                string // overrides the collector host name during verification
+
+	mu    sync.RWMutex
+	roots *x509.CertPool // nil means system roots
+	certs []tls.Certificate
+
+	generation atomic.Uint64 // incremented on every reload
+}
+
+// Loads the CA bundle and the client certificate/key pair (both optional)
+func LoadTLSCredentials(caFile, certFile, keyFile, serverName string) (*TLSCredentials, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("client certificate and key must be given together")
+	}
+
+	c := &TLSCredentials{
+		caFile:     caFile,
+		certFile:   certFile,
+		keyFile:    keyFile,
+		serverName: serverName,
+	}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reads the certificate files again. On error, the previous material is kept.
+func (c *TLSCredentials) reload() error {
+	var roots *x509.CertPool
+	if c.caFile != "" {
+		pem, err := os.ReadFile(c.caFile)
+		if err != nil {
+			return err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return errors.New("no certificate found in " + c.caFile)
+		}
+	}
+
+	var certs []tls.Certificate
+	if c.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+		if err != nil {
+			return err
+		}
+		certs = append(certs, cert)
+	}
+
+	c.mu.Lock()
+	c.roots, c.certs = roots, certs
+	c.mu.Unlock()
+	c.generation.Add(1)
+
+	return nil
+}
+
+// Reloads the credentials whenever the process receives SIGHUP
+func (c *TLSCredentials) ReloadOnSighup() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+
+	for range sigs {
+		if err := c.reload(); err != nil {
+			log.Printf("failed to reload TLS credentials: %v", err)
+			continue
+		}
+		log.Println("[IOAM Exporter] TLS credentials reloaded")
+	}
+}
+
+// TLS client configuration towards the given collector host
+func (c *TLSCredentials) tlsConfig(host string) *tls.Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return &tls.Config{
+		RootCAs:      c.roots,
+		Certificates: c.certs,
+		ServerName:   c.verifiedName(host),
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// DTLS client configuration towards the given collector host
+func (c *TLSCredentials) dtlsConfig(host string) *dtls.Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return &dtls.Config{
+		RootCAs:              c.roots,
+		Certificates:         c.certs,
+		ServerName:           c.verifiedName(host),
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+	}
+}
+
+// Name the collector certificate must match
+func (c *TLSCredentials) verifiedName(host string) string {
+	if c.serverName != "" {
+		return c.serverName
+	}
+	return host
+}
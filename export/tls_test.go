@@ -0,0 +1,307 @@
+package export
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pion/dtls/v3"
+)
+
+// Self-signed certificate authority issuing the certificates of a test
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	pem  []byte
+}
+
+// Creates a certificate authority
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// Issues a certificate for the loopback collector, or for a client, and
+// returns it along with its PEM encoding and the one of its key
+func (ca *testCA) issue(t *testing.T, client bool) (tls.Certificate, []byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "collector"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if client {
+		template.Subject.CommonName = "exporter"
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, certPEM, keyPEM
+}
+
+// Writes a file in the test directory and returns its name
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	fileName := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(fileName, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+// Accepts the sessions of a listener and reads the first IPFIX message of
+// each of them
+func receiveFirstMessages(ln net.Listener) chan []byte {
+	msgs := make(chan []byte, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				// DTLS delivers a whole datagram per read
+				buf := make([]byte, 65535)
+				n, err := io.ReadAtLeast(conn, buf, 16)
+				if err == nil && n >= int(binary.BigEndian.Uint16(buf[2:4])) {
+					msgs <- buf[:n]
+				}
+			}()
+		}
+	}()
+	return msgs
+}
+
+// Waits for a message from the collector
+func waitMessage(t *testing.T, msgs chan []byte) []byte {
+	t.Helper()
+
+	select {
+	case msg := <-msgs:
+		if version := binary.BigEndian.Uint16(msg[0:2]); version != 10 {
+			t.Errorf("IPFIX version %d", version)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("collector received nothing")
+		return nil
+	}
+}
+
+func TestTLSMutualAuthentication(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, _, _ := ca.issue(t, false)
+	_, clientPEM, clientKeyPEM := ca.issue(t, true)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	msgs := receiveFirstMessages(ln)
+
+	creds, err := LoadTLSCredentials(writeTestFile(t, "ca.pem", ca.pem), writeTestFile(t, "client.pem", clientPEM),
+		writeTestFile(t, "client.key", clientKeyPEM), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewExporter("tls://"+ln.Addr().String(), Config{MTU: DEFAULT_MTU, Creds: creds})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	if err := e.Export(testExportTrace); err != nil {
+		t.Fatal(err)
+	}
+	waitMessage(t, msgs)
+}
+
+func TestDTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, _, _ := ca.issue(t, false)
+
+	ln, err := dtls.Listen("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, &dtls.Config{
+		Certificates:         []tls.Certificate{serverCert},
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	msgs := receiveFirstMessages(ln)
+
+	creds, err := LoadTLSCredentials(writeTestFile(t, "ca.pem", ca.pem), "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewExporter("dtls://"+ln.Addr().String(), Config{MTU: DEFAULT_MTU, Creds: creds})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	if err := e.Export(testExportTrace); err != nil {
+		t.Fatal(err)
+	}
+	msg := waitMessage(t, msgs)
+	if got := int(binary.BigEndian.Uint16(msg[2:4])); got != len(msg) {
+		t.Errorf("message length %d in a %d-byte datagram", got, len(msg))
+	}
+}
+
+func TestTLSUntrustedCollector(t *testing.T) {
+	serverCert, _, _ := newTestCA(t).issue(t, false)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{serverCert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	msgs := receiveFirstMessages(ln)
+
+	// The exporter trusts another CA
+	creds, err := LoadTLSCredentials(writeTestFile(t, "ca.pem", newTestCA(t).pem), "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewExporter("tls://"+ln.Addr().String(), Config{MTU: DEFAULT_MTU, Creds: creds})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	var certErr *tls.CertificateVerificationError
+	if err := e.Export(testExportTrace); !errors.As(err, &certErr) {
+		t.Fatalf("export to an untrusted collector: got %v", err)
+	}
+	if e.State() != "down" || e.Stats.DialErrors.Load() != 1 {
+		t.Errorf("%s after %d connection errors", e.State(), e.Stats.DialErrors.Load())
+	}
+	select {
+	case <-msgs:
+		t.Error("untrusted collector received a message")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTLSReloadOnSighup(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert, _, _ := ca.issue(t, false)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{serverCert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	msgs := receiveFirstMessages(ln)
+
+	// The CA bundle is replaced while the exporter runs
+	caFile := writeTestFile(t, "ca.pem", newTestCA(t).pem)
+	creds, err := LoadTLSCredentials(caFile, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewExporter("tls://"+ln.Addr().String(), Config{MTU: DEFAULT_MTU, Creds: creds})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	if err := e.Export(testExportTrace); err == nil {
+		t.Fatal("export to an untrusted collector succeeded")
+	}
+
+	// SIGHUP must not stop the test if it arrives before ReloadOnSighup
+	// listens to it
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+	go creds.ReloadOnSighup()
+
+	if err := os.WriteFile(caFile, ca.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	generation := creds.generation.Load()
+	deadline := time.Now().Add(5 * time.Second)
+	for creds.generation.Load() == generation && time.Now().Before(deadline) {
+		syscall.Kill(os.Getpid(), syscall.SIGHUP)
+		time.Sleep(20 * time.Millisecond)
+	}
+	if creds.generation.Load() == generation {
+		t.Fatal("credentials not reloaded")
+	}
+
+	time.Sleep(EXPORTER_BACKOFF_MIN)
+	if err := e.Export(testExportTrace); err != nil {
+		t.Fatalf("export after reload: %v", err)
+	}
+	waitMessage(t, msgs)
+}
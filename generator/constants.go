@@ -0,0 +1,8 @@
+package generator
+
+// Kinds of generated events
+const (
+	KIND_TRACE = "trace" // pre-allocated trace events with every node filled
+	KIND_DEX   = "dex"   // direct export events
+	KIND_MIXED = "mixed" // trace and DEX events in turn
+)
@@ -0,0 +1,248 @@
+// Package generator synthesises the IOAM6 generic netlink events sent by the
+// kernel, to test and benchmark the exporter without IOAM traffic
+package generator
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+)
+
+// Parameters of the generated events
+type Config struct {
+	Kind        string   // KIND_TRACE, KIND_DEX or KIND_MIXED
+	TraceType   uint32   // 24-bit IOAM trace type
+	Hops        int      // nodes per trace event
+	SnapshotLen int      // bytes of opaque state snapshot per node with bit 22, multiple of 4
+	Namespaces  []uint16 // used in turn, default: namespace 0
+	Rate        float64  // events per second, 0 for as fast as possible
+	Count       uint64   // number of events, 0 for no limit
+	Seed        int64    // seed of the field values
+}
+
+// Generator of IOAM6 events
+type Generator struct {
+	config Config
+	rng    *rand.Rand
+	events uint64 // generated events
+	dexSeq uint32 // sequence number of the DEX events
+}
+
+// Creates a generator, checking that the events fit in an IOAM option
+func New(config Config) (*Generator, error) {
+	switch config.Kind {
+	case KIND_TRACE, KIND_DEX, KIND_MIXED:
+	default:
+		return nil, fmt.Errorf("unknown event kind %q", config.Kind)
+	}
+	if config.TraceType > 0xFFFFFF {
+		return nil, fmt.Errorf("trace type %#x longer than 24 bits", config.TraceType)
+	}
+	if config.Hops < 1 {
+		return nil, errors.New("number of hops must be positive")
+	}
+	if config.SnapshotLen%4 != 0 || config.SnapshotLen > 255*4 {
+		return nil, fmt.Errorf("snapshot length %d is not a multiple of 4 up to 1020", config.SnapshotLen)
+	}
+	if config.Rate < 0 {
+		return nil, errors.New("rate must not be negative")
+	}
+	if len(config.Namespaces) == 0 {
+		config.Namespaces = []uint16{0}
+	}
+
+	g := &Generator{config: config, rng: rand.New(rand.NewSource(config.Seed))}
+	if config.Kind != KIND_DEX {
+		if size := config.Hops * g.nodeSize(); size > ioam.IOAM6_TRACE_DATA_SIZE_MAX {
+			return nil, fmt.Errorf("trace of %d bytes longer than %d bytes", size, ioam.IOAM6_TRACE_DATA_SIZE_MAX)
+		}
+	}
+
+	return g, nil
+}
+
+// Generates the next event
+func (g *Generator) Next() genetlink.Message {
+	namespace := g.config.Namespaces[g.events%uint64(len(g.config.Namespaces))]
+	dex := g.config.Kind == KIND_DEX || (g.config.Kind == KIND_MIXED && g.events%2 == 1)
+	g.events++
+
+	if dex {
+		return g.dexEvent(namespace)
+	}
+	return g.traceEvent(namespace)
+}
+
+// Generates events at the configured rate and hands them to emit, until the
+// count is reached, emit fails or the context is done
+func (g *Generator) Run(ctx context.Context, emit func(msg genetlink.Message, at time.Time) error) error {
+	start := time.Now()
+	for i := uint64(0); g.config.Count == 0 || i < g.config.Count; i++ {
+		if g.config.Rate > 0 {
+			next := start.Add(time.Duration(float64(i) / g.config.Rate * float64(time.Second)))
+			if wait := time.Until(next); wait > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := emit(g.Next(), time.Now()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Number of events generated so far
+func (g *Generator) Events() uint64 {
+	return g.events
+}
+
+// Size in bytes of the data of a node, including its opaque state snapshot
+func (g *Generator) nodeSize() int {
+	// Bits 0 to 21
+	fields := g.config.TraceType & 0xFFFFFC
+	size := 4*bits.OnesCount32(fields&^ioam.TRACE_TYPE_WIDE_MASK) + 8*bits.OnesCount32(fields&ioam.TRACE_TYPE_WIDE_MASK)
+	if g.config.TraceType&ioam.TRACE_TYPE_BIT22_MASK != 0 {
+		size += 4 + g.config.SnapshotLen
+	}
+	return size
+}
+
+// Pre-allocated trace event: the most recent node comes first, as in the
+// option (RFC 9197 section 4.4)
+func (g *Generator) traceEvent(namespace uint16) genetlink.Message {
+	var data []byte
+	for hop := g.config.Hops; hop > 0; hop-- {
+		data = g.appendNode(data, uint32(hop))
+	}
+
+	attrs := []netlink.Attribute{
+		{Type: ioam.IOAM6_EVENT_ATTR_TRACE_NAMESPACE, Data: binary.LittleEndian.AppendUint16(nil, namespace)},
+		{Type: ioam.IOAM6_EVENT_ATTR_TRACE_NODELEN, Data: []byte{uint8(g.nodeLen())}},
+		{Type: ioam.IOAM6_EVENT_ATTR_TRACE_TYPE, Data: binary.LittleEndian.AppendUint32(nil, g.config.TraceType<<8)},
+		{Type: ioam.IOAM6_EVENT_ATTR_TRACE_DATA, Data: data},
+	}
+
+	return g.message(ioam.IOAM6_EVENT_TYPE_TRACE, attrs)
+}
+
+// DEX event: the data of a single node, one attribute per field
+func (g *Generator) dexEvent(namespace uint16) genetlink.Message {
+	g.dexSeq++
+	attrs := []netlink.Attribute{
+		{Type: ioam.IOAM6_EVENT_ATTR_OPTION_TYPE, Data: []byte{ioam.IOAM6_OPTION_TYPE_DEX}},
+		{Type: ioam.IOAM6_EVENT_ATTR_DEX_NAMESPACE, Data: binary.LittleEndian.AppendUint16(nil, namespace)},
+		{Type: ioam.IOAM6_EVENT_ATTR_DEX_FLOW_ID, Data: binary.LittleEndian.AppendUint32(nil, uint32(namespace))},
+		{Type: ioam.IOAM6_EVENT_ATTR_DEX_SEQ_NUM, Data: binary.LittleEndian.AppendUint32(nil, g.dexSeq)},
+	}
+
+	// Bits 0 to 21 have an attribute each, holding the field as in a trace
+	for bit := range 22 {
+		mask := uint32(ioam.TRACE_TYPE_BIT0_MASK) >> bit
+		if g.config.TraceType&mask == 0 {
+			continue
+		}
+		attrType := uint16(ioam.IOAM6_EVENT_ATTR_DEX_DATA_HOP_LIM_NODE_ID + bit)
+		if bit == 12 {
+			attrType = ioam.IOAM6_EVENT_ATTR_DEX_BIT_12
+		} else if bit > 12 {
+			attrType = uint16(ioam.IOAM6_EVENT_ATTR_DEX_BIT_13 + bit - 13)
+		}
+		attrs = append(attrs, netlink.Attribute{Type: attrType, Data: g.appendField(nil, mask, 1)})
+	}
+
+	if g.config.TraceType&ioam.TRACE_TYPE_BIT22_MASK != 0 {
+		attrs = append(attrs,
+			netlink.Attribute{Type: ioam.IOAM6_EVENT_ATTR_DEX_OSS_SCID, Data: binary.BigEndian.AppendUint32(nil, g.rng.Uint32()&0xFFFFFF)},
+			netlink.Attribute{Type: ioam.IOAM6_EVENT_ATTR_DEX_OSS_DATA, Data: g.snapshot()})
+	}
+
+	return g.message(ioam.IOAM6_EVENT_TYPE_DEX, attrs)
+}
+
+// NodeLen of the trace type, in 4-octet units without the snapshot
+func (g *Generator) nodeLen() int {
+	size := g.nodeSize()
+	if g.config.TraceType&ioam.TRACE_TYPE_BIT22_MASK != 0 {
+		size -= 4 + g.config.SnapshotLen
+	}
+	return size / 4
+}
+
+// Appends the data of a node, field by field in trace-type order
+func (g *Generator) appendNode(data []byte, hop uint32) []byte {
+	for bit := range 22 {
+		mask := uint32(ioam.TRACE_TYPE_BIT0_MASK) >> bit
+		if g.config.TraceType&mask != 0 {
+			data = g.appendField(data, mask, hop)
+		}
+	}
+
+	if g.config.TraceType&ioam.TRACE_TYPE_BIT22_MASK != 0 {
+		data = binary.BigEndian.AppendUint32(data, uint32(g.config.SnapshotLen/4)<<24|g.rng.Uint32()&0xFFFFFF)
+		data = append(data, g.snapshot()...)
+	}
+
+	return data
+}
+
+// Appends the field of a trace-type bit. Node IDs are the hop number, so
+// that paths stay stable across events; other values are random.
+func (g *Generator) appendField(data []byte, mask uint32, hop uint32) []byte {
+	hopLimit := uint32(64 - hop%64)
+	now := time.Now()
+
+	switch mask {
+	case ioam.TRACE_TYPE_BIT0_MASK:
+		return binary.BigEndian.AppendUint32(data, hopLimit<<24|hop)
+	case ioam.TRACE_TYPE_BIT2_MASK:
+		return binary.BigEndian.AppendUint32(data, uint32(now.Unix()))
+	case ioam.TRACE_TYPE_BIT3_MASK:
+		return binary.BigEndian.AppendUint32(data, uint32(now.Nanosecond()))
+	case ioam.TRACE_TYPE_BIT4_MASK:
+		// Transit delay, without the overflow bit
+		return binary.BigEndian.AppendUint32(data, g.rng.Uint32()>>1)
+	case ioam.TRACE_TYPE_BIT8_MASK:
+		return binary.BigEndian.AppendUint64(data, uint64(hopLimit)<<56|uint64(hop))
+	case ioam.TRACE_TYPE_BIT9_MASK, ioam.TRACE_TYPE_BIT10_MASK:
+		return binary.BigEndian.AppendUint64(data, g.rng.Uint64())
+	}
+	if mask&ioam.TRACE_TYPE_UNDEFINED_MASK != 0 {
+		return binary.BigEndian.AppendUint32(data, 0xFFFFFFFF)
+	}
+
+	return binary.BigEndian.AppendUint32(data, g.rng.Uint32())
+}
+
+// Random opaque state snapshot of the configured length
+func (g *Generator) snapshot() []byte {
+	snapshot := make([]byte, g.config.SnapshotLen)
+	g.rng.Read(snapshot)
+	return snapshot
+}
+
+// Wraps attributes in a generic netlink message of the IOAM6 family
+func (g *Generator) message(command uint8, attrs []netlink.Attribute) genetlink.Message {
+	// Attributes built above are always valid
+	data, _ := netlink.MarshalAttributes(attrs)
+	return genetlink.Message{
+		Header: genetlink.Header{Command: command, Version: ioam.IOAM6_GENL_VERSION},
+		Data:   data,
+	}
+}
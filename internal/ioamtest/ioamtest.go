@@ -0,0 +1,301 @@
+// Package ioamtest builds IOAM traces and their encodings in netlink events,
+// packets and capture files, for the tests of the other packages
+package ioamtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/Advanced-Observability/ioam-exporter/source/pcap"
+)
+
+// Trace-type bits 0 to 11, whose fields are decoded
+const DefinedFieldsMask = 0xFFF000
+
+// Trace of namespace 123 as decoded from an option of the given type and
+// header, with the given hops in path order
+func Trace(traceType uint32, optionType uint8, header ioam.TraceHeader, hops ...ioam.IoamNode) ioam.IoamTrace {
+	trace := ioam.IoamTrace{OptionType: optionType, Namespace: 123, TraceType: traceType, Hops: slices.Clone(hops)}
+	if ioam.HasTraceHeader(optionType) {
+		trace.Header = header
+	}
+	return trace
+}
+
+// Node data list of a trace, whose hops are given in path order: most recent
+// node first
+func TraceData(trace ioam.IoamTrace) []byte {
+	var data []byte
+	for i := len(trace.Hops) - 1; i >= 0; i-- {
+		data = append(data, NodeData(trace.TraceType, trace.Hops[i])...)
+	}
+	return data
+}
+
+// Node with a distinct value in every field of the trace type, the other
+// fields being left empty as done by the decoders
+func Node(traceType uint32, seed uint32) ioam.IoamNode {
+	var node ioam.IoamNode
+
+	if traceType&(ioam.TRACE_TYPE_BIT0_MASK|ioam.TRACE_TYPE_BIT8_MASK) != 0 {
+		node.HopLimit = uint8(64 - seed)
+	}
+	if traceType&ioam.TRACE_TYPE_BIT0_MASK != 0 {
+		node.NodeId = 0x010203 + seed
+	}
+	if traceType&ioam.TRACE_TYPE_BIT1_MASK != 0 {
+		node.IngressId, node.EgressId = uint16(10+seed), uint16(20+seed)
+	}
+	if traceType&ioam.TRACE_TYPE_BIT2_MASK != 0 {
+		node.TimestampSecs = 1700000000 + seed
+	}
+	if traceType&ioam.TRACE_TYPE_BIT3_MASK != 0 {
+		node.TimestampFrac = 30 + seed
+	}
+	if traceType&ioam.TRACE_TYPE_BIT4_MASK != 0 {
+		node.TransitDelay = 40 + seed
+	}
+	if traceType&ioam.TRACE_TYPE_BIT5_MASK != 0 {
+		node.NamespaceData = 50 + seed
+	}
+	if traceType&ioam.TRACE_TYPE_BIT6_MASK != 0 {
+		node.QueueDepth = 60 + seed
+	}
+	if traceType&ioam.TRACE_TYPE_BIT7_MASK != 0 {
+		node.ChecksumComplement = 70 + seed
+	}
+	if traceType&ioam.TRACE_TYPE_BIT8_MASK != 0 {
+		node.NodeIdWide = 0x01020304050607 + uint64(seed)
+	}
+	if traceType&ioam.TRACE_TYPE_BIT9_MASK != 0 {
+		node.IngressIdWide, node.EgressIdWide = 80+seed, 90+seed
+	}
+	if traceType&ioam.TRACE_TYPE_BIT10_MASK != 0 {
+		node.NamespaceDataWide = 0x0102030405060708 + uint64(seed)
+	}
+	if traceType&ioam.TRACE_TYPE_BIT11_MASK != 0 {
+		node.BufferOccupancy = 100 + seed
+	}
+	if traceType&ioam.TRACE_TYPE_BIT22_MASK != 0 {
+		node.OssSchema = 0x0A0B0C + seed
+		node.Snapshot = bytes.Repeat([]byte{byte(seed)}, 4*int(seed))
+		node.OssLen = uint8(seed)
+	}
+
+	return node
+}
+
+// Node data of a PTO trace, as written by the IOAM nodes (RFC 9197 section 4.4)
+func NodeData(traceType uint32, node ioam.IoamNode) []byte {
+	var data []byte
+
+	if traceType&ioam.TRACE_TYPE_BIT0_MASK != 0 {
+		data = binary.BigEndian.AppendUint32(data, uint32(node.HopLimit)<<24|node.NodeId)
+	}
+	if traceType&ioam.TRACE_TYPE_BIT1_MASK != 0 {
+		data = binary.BigEndian.AppendUint16(data, node.IngressId)
+		data = binary.BigEndian.AppendUint16(data, node.EgressId)
+	}
+	for _, field := range []struct {
+		mask  uint32
+		value uint32
+	}{
+		{ioam.TRACE_TYPE_BIT2_MASK, node.TimestampSecs},
+		{ioam.TRACE_TYPE_BIT3_MASK, node.TimestampFrac},
+		{ioam.TRACE_TYPE_BIT4_MASK, node.TransitDelay},
+		{ioam.TRACE_TYPE_BIT5_MASK, node.NamespaceData},
+		{ioam.TRACE_TYPE_BIT6_MASK, node.QueueDepth},
+		{ioam.TRACE_TYPE_BIT7_MASK, node.ChecksumComplement},
+	} {
+		if traceType&field.mask != 0 {
+			data = binary.BigEndian.AppendUint32(data, field.value)
+		}
+	}
+	if traceType&ioam.TRACE_TYPE_BIT8_MASK != 0 {
+		data = binary.BigEndian.AppendUint64(data, uint64(node.HopLimit)<<56|node.NodeIdWide)
+	}
+	if traceType&ioam.TRACE_TYPE_BIT9_MASK != 0 {
+		data = binary.BigEndian.AppendUint32(data, node.IngressIdWide)
+		data = binary.BigEndian.AppendUint32(data, node.EgressIdWide)
+	}
+	if traceType&ioam.TRACE_TYPE_BIT10_MASK != 0 {
+		data = binary.BigEndian.AppendUint64(data, node.NamespaceDataWide)
+	}
+	if traceType&ioam.TRACE_TYPE_BIT11_MASK != 0 {
+		data = binary.BigEndian.AppendUint32(data, node.BufferOccupancy)
+	}
+	for range bits.OnesCount32(traceType & ioam.TRACE_TYPE_UNDEFINED_MASK) {
+		data = binary.BigEndian.AppendUint32(data, 0xFFFFFFFF)
+	}
+	if traceType&ioam.TRACE_TYPE_BIT22_MASK != 0 {
+		data = binary.BigEndian.AppendUint32(data, uint32(len(node.Snapshot)/4)<<24|node.OssSchema)
+		data = append(data, node.Snapshot...)
+	}
+
+	return data
+}
+
+// Compares decoded traces, an empty snapshot being equivalent to none
+func EqualTraces(got, want ioam.IoamTrace) bool {
+	if !got.ReceivedAt.Equal(want.ReceivedAt) || !equalNodes(got.Hops, want.Hops) {
+		return false
+	}
+	got.ReceivedAt, want.ReceivedAt = time.Time{}, time.Time{}
+	got.Hops, want.Hops = nil, nil
+	return reflect.DeepEqual(got, want)
+}
+
+// Compares decoded nodes, an empty snapshot being equivalent to none
+func equalNodes(got, want []ioam.IoamNode) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		a, b := got[i], want[i]
+		if !bytes.Equal(a.Snapshot, b.Snapshot) {
+			return false
+		}
+		a.Snapshot, b.Snapshot = nil, nil
+		if !reflect.DeepEqual(a, b) {
+			return false
+		}
+	}
+	return true
+}
+
+// DEX export packet of a single-hop trace: DEX option header, flow ID and
+// sequence number if present, then the node data
+func DexExportPacket(trace ioam.IoamTrace) []byte {
+	var extFlags uint8
+	if trace.HasDexFlowID {
+		extFlags |= ioam.IOAM6_DEX_EXT_FLOW_ID
+	}
+	if trace.HasDexSeqNum {
+		extFlags |= ioam.IOAM6_DEX_EXT_SEQ_NUM
+	}
+
+	data := binary.BigEndian.AppendUint16(nil, trace.Namespace)
+	data = append(data, 0, extFlags)
+	data = binary.BigEndian.AppendUint32(data, trace.TraceType<<8)
+	if trace.HasDexFlowID {
+		data = binary.BigEndian.AppendUint32(data, trace.DexFlowID)
+	}
+	if trace.HasDexSeqNum {
+		data = binary.BigEndian.AppendUint32(data, trace.DexSeqNum)
+	}
+	return append(data, TraceData(trace)...)
+}
+
+// IOAM option data of a pre-allocated or incremental trace: reserved, option
+// type, trace header, free space and nodes
+func TraceOption(remainingLen uint8, trace ioam.IoamTrace) []byte {
+	nodeLen := ioam.PtoNodeLen(trace.TraceType)
+	data := []byte{0, trace.OptionType}
+	data = binary.BigEndian.AppendUint16(data, trace.Namespace)
+	data = binary.BigEndian.AppendUint16(data, uint16(nodeLen)<<11|uint16(remainingLen))
+	data = binary.BigEndian.AppendUint32(data, trace.TraceType<<8)
+	data = append(data, make([]byte, 4*int(remainingLen))...)
+	return append(data, TraceData(trace)...)
+}
+
+// Options header carrying an IOAM option, padded to 8 bytes
+func OptionsHeader(next uint8, option []byte) []byte {
+	header := append([]byte{next, 0, ioam.IPV6_OPT_IOAM, uint8(len(option))}, option...)
+	switch pad := (8 - len(header)%8) % 8; pad {
+	case 0:
+	case 1:
+		header = append(header, ioam.IPV6_OPT_PAD1)
+	default:
+		// PadN
+		header = append(header, 1, uint8(pad-2))
+		header = append(header, make([]byte, pad-2)...)
+	}
+	header[1] = uint8(len(header)/8 - 1)
+	return header
+}
+
+// IPv6 packet whose payload starts with the given next header
+func IPv6Packet(next uint8, payload []byte) []byte {
+	packet := make([]byte, ioam.IPV6_HEADER_LEN)
+	packet[0] = 0x60
+	binary.BigEndian.PutUint16(packet[4:6], uint16(len(payload)))
+	packet[6], packet[7] = next, 64
+	return append(packet, payload...)
+}
+
+// Ethernet frame with a VLAN tag
+func EthernetFrame(packet []byte) []byte {
+	frame := make([]byte, 12)
+	frame = binary.BigEndian.AppendUint16(frame, ioam.ETHERTYPE_VLAN)
+	frame = binary.BigEndian.AppendUint16(frame, 100)
+	frame = binary.BigEndian.AppendUint16(frame, ioam.ETHERTYPE_IPV6)
+	return append(frame, packet...)
+}
+
+// Writes a little-endian pcap file with microsecond timestamps
+func WritePcap(t *testing.T, linkType uint32, timestamps []time.Time, packets [][]byte) string {
+	data := binary.LittleEndian.AppendUint32(nil, pcap.PCAP_MAGIC_MICROSECONDS)
+	data = binary.LittleEndian.AppendUint16(data, 2)
+	data = binary.LittleEndian.AppendUint16(data, 4)
+	data = append(data, make([]byte, 8)...)
+	data = binary.LittleEndian.AppendUint32(data, 65535)
+	data = binary.LittleEndian.AppendUint32(data, linkType)
+	for i, packet := range packets {
+		data = binary.LittleEndian.AppendUint32(data, uint32(timestamps[i].Unix()))
+		data = binary.LittleEndian.AppendUint32(data, uint32(timestamps[i].Nanosecond()/1000))
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(packet)))
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(packet)))
+		data = append(data, packet...)
+	}
+	return WriteTempFile(t, "packets.pcap", data)
+}
+
+// Writes a big-endian pcapng file with nanosecond timestamps
+func WritePcapng(t *testing.T, linkType uint16, timestamps []time.Time, packets [][]byte) string {
+	block := func(data []byte, blockType uint32, body []byte) []byte {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		data = binary.BigEndian.AppendUint32(data, blockType)
+		data = binary.BigEndian.AppendUint32(data, uint32(12+len(body)))
+		data = append(data, body...)
+		return binary.BigEndian.AppendUint32(data, uint32(12+len(body)))
+	}
+
+	section := binary.BigEndian.AppendUint32(nil, pcap.PCAPNG_BYTE_ORDER_MAGIC)
+	section = append(section, 0, 1, 0, 0, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	data := block(nil, pcap.PCAPNG_BLOCK_SECTION_HEADER, section)
+
+	intf := binary.BigEndian.AppendUint16(nil, linkType)
+	intf = append(intf, 0, 0, 0, 0, 0, 0)
+	intf = append(intf, 0, pcap.PCAPNG_OPTION_IF_TSRESOL, 0, 1, 9, 0, 0, 0, 0, pcap.PCAPNG_OPTION_END, 0, 0)
+	data = block(data, pcap.PCAPNG_BLOCK_INTERFACE, intf)
+
+	for i, packet := range packets {
+		ts := uint64(timestamps[i].UnixNano())
+		body := binary.BigEndian.AppendUint32(nil, 0)
+		body = binary.BigEndian.AppendUint32(body, uint32(ts>>32))
+		body = binary.BigEndian.AppendUint32(body, uint32(ts))
+		body = binary.BigEndian.AppendUint32(body, uint32(len(packet)))
+		body = binary.BigEndian.AppendUint32(body, uint32(len(packet)))
+		data = block(data, pcap.PCAPNG_BLOCK_ENHANCED_PACKET, append(body, packet...))
+	}
+	return WriteTempFile(t, "packets.pcapng", data)
+}
+
+// Writes data to a file of the temporary directory of the test
+func WriteTempFile(t *testing.T, name string, data []byte) string {
+	fileName := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(fileName, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
@@ -0,0 +1,147 @@
+package ioam
+
+// IOAM6 generic netlink family of the kernel
+const (
+	IOAM6_GENL_NAME       string = "IOAM6"
+	IOAM6_GENL_GROUP_NAME string = "ioam6_events"
+	IOAM6_GENL_VERSION           = 1
+)
+
+// IOAM generic netlink command
+const (
+	IOAM6_EVENT_TYPE_TRACE = 1
+	IOAM6_EVENT_TYPE_DEX   = 2
+)
+
+// IOAM generic netlink attribute types
+const (
+	IOAM6_EVENT_ATTR_TRACE_NAMESPACE = 1
+	IOAM6_EVENT_ATTR_TRACE_NODELEN   = 2
+	IOAM6_EVENT_ATTR_TRACE_TYPE      = 3
+	IOAM6_EVENT_ATTR_TRACE_DATA      = 4
+
+	IOAM6_EVENT_ATTR_OPTION_TYPE = 5
+
+	IOAM6_EVENT_ATTR_DEX_NAMESPACE = 6
+	IOAM6_EVENT_ATTR_DEX_FLOW_ID   = 7
+	IOAM6_EVENT_ATTR_DEX_SEQ_NUM   = 8
+
+	IOAM6_EVENT_ATTR_DEX_DATA_HOP_LIM_NODE_ID                = 9
+	IOAM6_EVENT_ATTR_DEX_DATA_INGRESS_EGRESS_INTERFACES      = 10
+	IOAM6_EVENT_ATTR_DEX_DATA_TIMESTAMP                      = 11
+	IOAM6_EVENT_ATTR_DEX_DATA_TIMESTAMP_FRAC                 = 12
+	IOAM6_EVENT_ATTR_DEX_DATA_TRANSIT                        = 13
+	IOAM6_EVENT_ATTR_DEX_DATA_NAMESPACE_SPECIFIC             = 14
+	IOAM6_EVENT_ATTR_DEX_DATA_QUEUE_DEPTH                    = 15
+	IOAM6_EVENT_ATTR_DEX_DATA_CHECKSUM                       = 16
+	IOAM6_EVENT_ATTR_DEX_DATA_HOP_LIM_NODE_ID_WIDE           = 17
+	IOAM6_EVENT_ATTR_DEX_DATA_INGRESS_EGRESS_INTERFACES_WIDE = 18
+	IOAM6_EVENT_ATTR_DEX_DATA_NAMESPACE_SPECIFIC_WIDE        = 19
+	IOAM6_EVENT_ATTR_DEX_DATA_BUFFER_OCCUPANCY               = 20
+	IOAM6_EVENT_ATTR_DEX_BIT_13                              = 21
+	IOAM6_EVENT_ATTR_DEX_BIT_14                              = 22
+	IOAM6_EVENT_ATTR_DEX_BIT_15                              = 23
+	IOAM6_EVENT_ATTR_DEX_BIT_16                              = 24
+	IOAM6_EVENT_ATTR_DEX_BIT_17                              = 25
+	IOAM6_EVENT_ATTR_DEX_BIT_18                              = 26
+	IOAM6_EVENT_ATTR_DEX_BIT_19                              = 27
+	IOAM6_EVENT_ATTR_DEX_BIT_20                              = 28
+	IOAM6_EVENT_ATTR_DEX_BIT_21                              = 29
+	IOAM6_EVENT_ATTR_DEX_BIT_12                              = 30
+	IOAM6_EVENT_ATTR_DEX_OSS_SCID                            = 31
+	IOAM6_EVENT_ATTR_DEX_OSS_DATA                            = 32
+
+	IOAM6_EVENT_ATTR_TRACE_FLAGS  = 33 // u8, 4 bits
+	IOAM6_EVENT_ATTR_TRACE_REMLEN = 34 // u8, 7 bits
+)
+
+// Link types of captured packets (tcpdump.org/linktypes.html)
+const (
+	LINKTYPE_NULL       = 0 // BSD loopback
+	LINKTYPE_ETHERNET   = 1
+	DLT_RAW             = 14 // raw IP on OpenBSD
+	LINKTYPE_RAW        = 101
+	LINKTYPE_LINUX_SLL  = 113
+	LINKTYPE_IPV6       = 229
+	LINKTYPE_LINUX_SLL2 = 276
+
+	ETHERTYPE_VLAN = 0x8100
+	ETHERTYPE_QINQ = 0x88A8
+	ETHERTYPE_IPV6 = 0x86DD
+)
+
+// IPv6 headers and options
+const (
+	IPV6_HEADER_LEN        = 40
+	IPV6_MAX_ENCAPSULATION = 4 // nested IPv6-in-IPv6 packets walked
+
+	IPPROTO_HOPOPTS  = 0
+	IPPROTO_IPV6     = 41
+	IPPROTO_ROUTING  = 43
+	IPPROTO_FRAGMENT = 44
+	IPPROTO_AH       = 51
+	IPPROTO_DSTOPTS  = 60
+
+	IPV6_OPT_PAD1 = 0
+	IPV6_OPT_PADN = 1
+	IPV6_OPT_IOAM = 0x31 // RFC 9486
+)
+
+// IOAM-related constants
+const (
+	IOAM6_TRACE_DATA_SIZE_MAX = 244
+
+	IOAM6_OPTION_TYPE_PREALLOC    = 0
+	IOAM6_OPTION_TYPE_INCREMENTAL = 1
+	IOAM6_OPTION_TYPE_POT         = 2
+	IOAM6_OPTION_TYPE_E2E         = 3
+	IOAM6_OPTION_TYPE_DEX         = 4
+
+	IOAM6_TRACE_HEADER_LEN    = 8 // namespace, lengths, flags and trace type
+	IOAM6_TRACE_FLAG_OVERFLOW = 0x8
+	IOAM6_DEX_HEADER_LEN      = 8 // namespace, flags, extension flags, trace type and reserved
+	IOAM6_DEX_EXT_FLOW_ID     = 0x80
+	IOAM6_DEX_EXT_SEQ_NUM     = 0x40
+	IOAM6_POT_HEADER_LEN      = 4 // namespace, POT type and flags
+	IOAM6_POT_TYPE_0          = 0
+	IOAM6_POT_TYPE_0_LEN      = 16 // random number and cumulative value
+	IOAM6_E2E_HEADER_LEN      = 4  // namespace and E2E type
+
+	E2E_TYPE_BIT0_MASK = 1 << 15 // 64-bit sequence number
+	E2E_TYPE_BIT1_MASK = 1 << 14 // 32-bit sequence number
+	E2E_TYPE_BIT2_MASK = 1 << 13 // timestamp seconds
+	E2E_TYPE_BIT3_MASK = 1 << 12 // timestamp fraction
+	E2E_REORDER_WINDOW = 1024    // missing sequence numbers remembered to tell late packets from duplicates
+
+	TRACE_TYPE_BIT0_MASK  = 1 << 23
+	TRACE_TYPE_BIT1_MASK  = 1 << 22
+	TRACE_TYPE_BIT2_MASK  = 1 << 21
+	TRACE_TYPE_BIT3_MASK  = 1 << 20
+	TRACE_TYPE_BIT4_MASK  = 1 << 19
+	TRACE_TYPE_BIT5_MASK  = 1 << 18
+	TRACE_TYPE_BIT6_MASK  = 1 << 17
+	TRACE_TYPE_BIT7_MASK  = 1 << 16
+	TRACE_TYPE_BIT8_MASK  = 1 << 15
+	TRACE_TYPE_BIT9_MASK  = 1 << 14
+	TRACE_TYPE_BIT10_MASK = 1 << 13
+	TRACE_TYPE_BIT11_MASK = 1 << 12
+	TRACE_TYPE_BIT12_MASK = 1 << 11
+	TRACE_TYPE_BIT13_MASK = 1 << 10
+	TRACE_TYPE_BIT14_MASK = 1 << 9
+	TRACE_TYPE_BIT15_MASK = 1 << 8
+	TRACE_TYPE_BIT16_MASK = 1 << 7
+	TRACE_TYPE_BIT17_MASK = 1 << 6
+	TRACE_TYPE_BIT18_MASK = 1 << 5
+	TRACE_TYPE_BIT19_MASK = 1 << 4
+	TRACE_TYPE_BIT20_MASK = 1 << 3
+	TRACE_TYPE_BIT21_MASK = 1 << 2
+	TRACE_TYPE_BIT22_MASK = 1 << 1
+
+	// Fields of 8 bytes, the others being 4 bytes long
+	TRACE_TYPE_WIDE_MASK = TRACE_TYPE_BIT8_MASK | TRACE_TYPE_BIT9_MASK | TRACE_TYPE_BIT10_MASK
+
+	// Undefined bits 12-21: 4 bytes each, filled with 0xFFFFFFFF (RFC 9197 section 4.4.1)
+	TRACE_TYPE_UNDEFINED_MASK = TRACE_TYPE_BIT12_MASK | TRACE_TYPE_BIT13_MASK | TRACE_TYPE_BIT14_MASK |
+		TRACE_TYPE_BIT15_MASK | TRACE_TYPE_BIT16_MASK | TRACE_TYPE_BIT17_MASK | TRACE_TYPE_BIT18_MASK |
+		TRACE_TYPE_BIT19_MASK | TRACE_TYPE_BIT20_MASK | TRACE_TYPE_BIT21_MASK
+)
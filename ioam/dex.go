@@ -0,0 +1,140 @@
+package ioam
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mdlayher/netlink"
+)
+
+// Minimum length of the DEX netlink attributes
+var dexAttrLen = map[uint16]int{
+	IOAM6_EVENT_ATTR_OPTION_TYPE:                             1,
+	IOAM6_EVENT_ATTR_DEX_NAMESPACE:                           2,
+	IOAM6_EVENT_ATTR_DEX_FLOW_ID:                             4,
+	IOAM6_EVENT_ATTR_DEX_SEQ_NUM:                             4,
+	IOAM6_EVENT_ATTR_DEX_DATA_HOP_LIM_NODE_ID:                4,
+	IOAM6_EVENT_ATTR_DEX_DATA_INGRESS_EGRESS_INTERFACES:      4,
+	IOAM6_EVENT_ATTR_DEX_DATA_TIMESTAMP:                      4,
+	IOAM6_EVENT_ATTR_DEX_DATA_TIMESTAMP_FRAC:                 4,
+	IOAM6_EVENT_ATTR_DEX_DATA_TRANSIT:                        4,
+	IOAM6_EVENT_ATTR_DEX_DATA_NAMESPACE_SPECIFIC:             4,
+	IOAM6_EVENT_ATTR_DEX_DATA_QUEUE_DEPTH:                    4,
+	IOAM6_EVENT_ATTR_DEX_DATA_CHECKSUM:                       4,
+	IOAM6_EVENT_ATTR_DEX_DATA_HOP_LIM_NODE_ID_WIDE:           8,
+	IOAM6_EVENT_ATTR_DEX_DATA_INGRESS_EGRESS_INTERFACES_WIDE: 8,
+	IOAM6_EVENT_ATTR_DEX_DATA_NAMESPACE_SPECIFIC_WIDE:        8,
+	IOAM6_EVENT_ATTR_DEX_DATA_BUFFER_OCCUPANCY:               4,
+	IOAM6_EVENT_ATTR_DEX_OSS_SCID:                            4,
+}
+
+// Parses the netlink attributes for IOAM DEX
+func ExtractDexData(attrs []netlink.Attribute) (IoamTrace, error) {
+	trace := IoamTrace{OptionType: IOAM6_OPTION_TYPE_DEX}
+	var node IoamNode
+
+	for _, attr := range attrs {
+		if err := checkAttrLen(attr, dexAttrLen[attr.Type]); err != nil {
+			return IoamTrace{}, err
+		}
+
+		switch attr.Type {
+		case IOAM6_EVENT_ATTR_OPTION_TYPE:
+			if attr.Data[0] != IOAM6_OPTION_TYPE_DEX {
+				return IoamTrace{}, fmt.Errorf("%w: %d in DEX event", ErrUnknownOptionType, attr.Data[0])
+			}
+		case IOAM6_EVENT_ATTR_DEX_NAMESPACE:
+			trace.Namespace = binary.LittleEndian.Uint16(attr.Data)
+		case IOAM6_EVENT_ATTR_DEX_FLOW_ID:
+			trace.DexFlowID = binary.LittleEndian.Uint32(attr.Data)
+			trace.HasDexFlowID = true
+		case IOAM6_EVENT_ATTR_DEX_SEQ_NUM:
+			trace.DexSeqNum = binary.LittleEndian.Uint32(attr.Data)
+			trace.HasDexSeqNum = true
+		case IOAM6_EVENT_ATTR_DEX_DATA_HOP_LIM_NODE_ID:
+			node.HopLimit = uint8(attr.Data[0])
+			node.NodeId = binary.BigEndian.Uint32(attr.Data) & 0xFFFFFF
+			trace.TraceType |= TRACE_TYPE_BIT0_MASK
+		case IOAM6_EVENT_ATTR_DEX_DATA_INGRESS_EGRESS_INTERFACES:
+			node.IngressId = binary.BigEndian.Uint16(attr.Data[0:2])
+			node.EgressId = binary.BigEndian.Uint16(attr.Data[2:4])
+			trace.TraceType |= TRACE_TYPE_BIT1_MASK
+		case IOAM6_EVENT_ATTR_DEX_DATA_TIMESTAMP:
+			node.TimestampSecs = binary.BigEndian.Uint32(attr.Data)
+			trace.TraceType |= TRACE_TYPE_BIT2_MASK
+		case IOAM6_EVENT_ATTR_DEX_DATA_TIMESTAMP_FRAC:
+			node.TimestampFrac = binary.BigEndian.Uint32(attr.Data)
+			trace.TraceType |= TRACE_TYPE_BIT3_MASK
+		case IOAM6_EVENT_ATTR_DEX_DATA_TRANSIT:
+			node.TransitDelay = binary.BigEndian.Uint32(attr.Data)
+			trace.TraceType |= TRACE_TYPE_BIT4_MASK
+		case IOAM6_EVENT_ATTR_DEX_DATA_NAMESPACE_SPECIFIC:
+			node.NamespaceData = binary.BigEndian.Uint32(attr.Data)
+			trace.TraceType |= TRACE_TYPE_BIT5_MASK
+		case IOAM6_EVENT_ATTR_DEX_DATA_QUEUE_DEPTH:
+			node.QueueDepth = binary.BigEndian.Uint32(attr.Data)
+			trace.TraceType |= TRACE_TYPE_BIT6_MASK
+		case IOAM6_EVENT_ATTR_DEX_DATA_CHECKSUM:
+			node.ChecksumComplement = binary.BigEndian.Uint32(attr.Data)
+			trace.TraceType |= TRACE_TYPE_BIT7_MASK
+		case IOAM6_EVENT_ATTR_DEX_DATA_HOP_LIM_NODE_ID_WIDE:
+			node.HopLimit = uint8(attr.Data[0])
+			node.NodeIdWide = binary.BigEndian.Uint64(attr.Data) & 0xFFFFFFFFFFFFFF
+			trace.TraceType |= TRACE_TYPE_BIT8_MASK
+		case IOAM6_EVENT_ATTR_DEX_DATA_INGRESS_EGRESS_INTERFACES_WIDE:
+			node.IngressIdWide = binary.BigEndian.Uint32(attr.Data[0:4])
+			node.EgressIdWide = binary.BigEndian.Uint32(attr.Data[4:8])
+			trace.TraceType |= TRACE_TYPE_BIT9_MASK
+		case IOAM6_EVENT_ATTR_DEX_DATA_NAMESPACE_SPECIFIC_WIDE:
+			node.NamespaceDataWide = binary.BigEndian.Uint64(attr.Data)
+			trace.TraceType |= TRACE_TYPE_BIT10_MASK
+		case IOAM6_EVENT_ATTR_DEX_DATA_BUFFER_OCCUPANCY:
+			node.BufferOccupancy = binary.BigEndian.Uint32(attr.Data)
+			trace.TraceType |= TRACE_TYPE_BIT11_MASK
+		case IOAM6_EVENT_ATTR_DEX_BIT_12:
+			// Undefined fields carry no information
+			trace.TraceType |= TRACE_TYPE_BIT12_MASK
+		case IOAM6_EVENT_ATTR_DEX_BIT_13, IOAM6_EVENT_ATTR_DEX_BIT_14, IOAM6_EVENT_ATTR_DEX_BIT_15,
+			IOAM6_EVENT_ATTR_DEX_BIT_16, IOAM6_EVENT_ATTR_DEX_BIT_17, IOAM6_EVENT_ATTR_DEX_BIT_18,
+			IOAM6_EVENT_ATTR_DEX_BIT_19, IOAM6_EVENT_ATTR_DEX_BIT_20, IOAM6_EVENT_ATTR_DEX_BIT_21:
+			trace.TraceType |= TRACE_TYPE_BIT13_MASK >> (attr.Type - IOAM6_EVENT_ATTR_DEX_BIT_13)
+		case IOAM6_EVENT_ATTR_DEX_OSS_SCID:
+			node.OssSchema = binary.BigEndian.Uint32(attr.Data)
+		case IOAM6_EVENT_ATTR_DEX_OSS_DATA:
+			if len(attr.Data)%4 != 0 {
+				return IoamTrace{}, fmt.Errorf("%w: %d bytes", ErrTruncatedSnapshot, len(attr.Data))
+			}
+			if len(attr.Data) > 255*4 {
+				return IoamTrace{}, fmt.Errorf("%w: %d bytes", ErrSnapshotTooLong, len(attr.Data))
+			}
+			node.Snapshot = attr.Data
+			node.OssLen = uint8(len(node.Snapshot) / 4)
+			trace.TraceType |= TRACE_TYPE_BIT22_MASK
+		}
+	}
+
+	trace.Hops = []IoamNode{node}
+
+	return trace, nil
+}
+
+// Parses a DEX export packet received from a remote node: the DEX option
+// header and its optional fields, followed by the data of the exporting node
+// for the trace type of the header, laid out as in a trace
+func ParseDexExport(data []byte) (IoamTrace, error) {
+	trace, nodeData, err := parseDexOption(data)
+	if err != nil {
+		return IoamTrace{}, err
+	}
+
+	node, size, err := parseTraceNode(nodeData, trace.TraceType)
+	if err != nil {
+		return IoamTrace{}, err
+	}
+	if size != len(nodeData) {
+		return IoamTrace{}, fmt.Errorf("%w: %d bytes after the node data", ErrBadNodeLen, len(nodeData)-size)
+	}
+	trace.Hops = []IoamNode{node}
+
+	return trace, nil
+}
@@ -0,0 +1,185 @@
+package ioam_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/Advanced-Observability/ioam-exporter/internal/ioamtest"
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+)
+
+func TestExtractDexDataAllTraceTypes(t *testing.T) {
+	for combo := range uint32(1 << 12) {
+		for _, extra := range []uint32{0, ioam.TRACE_TYPE_BIT22_MASK, ioam.TRACE_TYPE_BIT12_MASK | ioam.TRACE_TYPE_BIT21_MASK} {
+			want := ioamtest.Trace(combo<<12|extra, ioam.IOAM6_OPTION_TYPE_DEX, ioam.TraceHeader{}, ioamtest.Node(combo<<12|extra, 2))
+			want.DexFlowID, want.HasDexFlowID = 7, combo%2 == 0
+			want.DexSeqNum, want.HasDexSeqNum = 8, combo%3 == 0
+			if !want.HasDexFlowID {
+				want.DexFlowID = 0
+			}
+			if !want.HasDexSeqNum {
+				want.DexSeqNum = 0
+			}
+
+			// Attributes unknown to the decoder are skipped
+			attrs := append(dexAttributes(want), netlink.Attribute{Type: 200, Data: []byte{1}})
+			trace, err := ioam.ExtractDexData(attrs)
+			if err != nil {
+				t.Fatalf("trace type %#06x: %v", want.TraceType, err)
+			}
+			if !ioamtest.EqualTraces(trace, want) {
+				t.Fatalf("trace type %#06x:\ngot  %+v\nwant %+v", want.TraceType, trace, want)
+			}
+		}
+	}
+}
+
+func TestExtractDexDataMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		attrs []netlink.Attribute
+		want  error
+	}{
+		{"option type", []netlink.Attribute{{Type: ioam.IOAM6_EVENT_ATTR_OPTION_TYPE, Data: []byte{0}}}, ioam.ErrUnknownOptionType},
+		{"short node ID", []netlink.Attribute{{Type: ioam.IOAM6_EVENT_ATTR_DEX_DATA_HOP_LIM_NODE_ID, Data: []byte{1, 2}}}, ioam.ErrTruncatedAttribute},
+		{"short wide node ID", []netlink.Attribute{{Type: ioam.IOAM6_EVENT_ATTR_DEX_DATA_HOP_LIM_NODE_ID_WIDE, Data: make([]byte, 4)}}, ioam.ErrTruncatedAttribute},
+		{"empty namespace", []netlink.Attribute{{Type: ioam.IOAM6_EVENT_ATTR_DEX_NAMESPACE}}, ioam.ErrTruncatedAttribute},
+		{"unaligned snapshot", []netlink.Attribute{{Type: ioam.IOAM6_EVENT_ATTR_DEX_OSS_DATA, Data: make([]byte, 5)}}, ioam.ErrTruncatedSnapshot},
+		{"oversized snapshot", []netlink.Attribute{{Type: ioam.IOAM6_EVENT_ATTR_DEX_OSS_DATA, Data: make([]byte, 256*4)}}, ioam.ErrSnapshotTooLong},
+	}
+	for _, tt := range tests {
+		if _, err := ioam.ExtractDexData(tt.attrs); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestParseDexExportAllTraceTypes(t *testing.T) {
+	for combo := range uint32(1 << 12) {
+		for _, extra := range []uint32{0, ioam.TRACE_TYPE_BIT22_MASK, ioam.TRACE_TYPE_BIT12_MASK | ioam.TRACE_TYPE_BIT21_MASK} {
+			want := ioamtest.Trace(combo<<12|extra, ioam.IOAM6_OPTION_TYPE_DEX, ioam.TraceHeader{}, ioamtest.Node(combo<<12|extra, 2))
+			if combo%2 == 0 {
+				want.DexFlowID, want.HasDexFlowID = 7, true
+			}
+			if combo%3 == 0 {
+				want.DexSeqNum, want.HasDexSeqNum = 8, true
+			}
+
+			trace, err := ioam.ParseDexExport(ioamtest.DexExportPacket(want))
+			if err != nil {
+				t.Fatalf("trace type %#06x: %v", want.TraceType, err)
+			}
+			if !ioamtest.EqualTraces(trace, want) {
+				t.Fatalf("trace type %#06x:\ngot  %+v\nwant %+v", want.TraceType, trace, want)
+			}
+		}
+	}
+}
+
+func TestParseDexExportMalformed(t *testing.T) {
+	trace := ioamtest.Trace(0xF00000|ioam.TRACE_TYPE_BIT22_MASK, ioam.IOAM6_OPTION_TYPE_DEX, ioam.TraceHeader{}, ioamtest.Node(0xF00000|ioam.TRACE_TYPE_BIT22_MASK, 1))
+	trace.DexFlowID, trace.HasDexFlowID = 7, true
+	packet := ioamtest.DexExportPacket(trace)
+
+	tests := []struct {
+		name   string
+		packet []byte
+		want   error
+	}{
+		{"short header", packet[:6], ioam.ErrTruncatedNode},
+		{"missing flow ID", packet[:10], ioam.ErrTruncatedNode},
+		{"short node data", packet[:20], ioam.ErrTruncatedNode},
+		{"short snapshot", packet[:len(packet)-1], ioam.ErrTruncatedSnapshot},
+		{"trailing bytes", append(packet, 0, 0, 0, 0), ioam.ErrBadNodeLen},
+	}
+	for _, tt := range tests {
+		if _, err := ioam.ParseDexExport(tt.packet); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func FuzzReadMessage(f *testing.F) {
+	for _, traceType := range []uint32{0xF00000, 0xFFF000 | ioam.TRACE_TYPE_BIT22_MASK} {
+		trace := ioamtest.Trace(traceType, ioam.IOAM6_OPTION_TYPE_DEX, ioam.TraceHeader{}, ioamtest.Node(traceType, 1))
+		pto, _ := netlink.MarshalAttributes(ptoAttributes(trace.Namespace, uint8(ioam.PtoNodeLen(traceType)), traceType, ioamtest.TraceData(trace)))
+		dex, _ := netlink.MarshalAttributes(dexAttributes(trace))
+		f.Add(uint8(ioam.IOAM6_EVENT_TYPE_TRACE), pto)
+		f.Add(uint8(ioam.IOAM6_EVENT_TYPE_DEX), dex)
+	}
+
+	f.Fuzz(func(t *testing.T, command uint8, data []byte) {
+		trace, err := ioam.ReadMessage(genetlink.Message{Header: genetlink.Header{Command: command}, Data: data})
+		if err != nil {
+			for _, class := range ioam.ErrorClasses {
+				if errors.Is(err, class) {
+					return
+				}
+			}
+			t.Fatalf("untyped error %v", err)
+		}
+		for _, node := range trace.Hops {
+			if node.NodeId > 0xFFFFFF || node.NodeIdWide > 0xFFFFFFFFFFFFFF || len(node.Snapshot) != 4*int(node.OssLen) {
+				t.Fatalf("invalid node %+v", node)
+			}
+		}
+	})
+}
+
+// Netlink attributes of a DEX event of a single-hop trace, as sent by the
+// kernel
+func dexAttributes(trace ioam.IoamTrace) []netlink.Attribute {
+	attrs := []netlink.Attribute{
+		{Type: ioam.IOAM6_EVENT_ATTR_OPTION_TYPE, Data: []byte{ioam.IOAM6_OPTION_TYPE_DEX}},
+		{Type: ioam.IOAM6_EVENT_ATTR_DEX_NAMESPACE, Data: binary.LittleEndian.AppendUint16(nil, trace.Namespace)},
+	}
+	if trace.HasDexFlowID {
+		attrs = append(attrs, netlink.Attribute{Type: ioam.IOAM6_EVENT_ATTR_DEX_FLOW_ID, Data: binary.LittleEndian.AppendUint32(nil, trace.DexFlowID)})
+	}
+	if trace.HasDexSeqNum {
+		attrs = append(attrs, netlink.Attribute{Type: ioam.IOAM6_EVENT_ATTR_DEX_SEQ_NUM, Data: binary.LittleEndian.AppendUint32(nil, trace.DexSeqNum)})
+	}
+	node := trace.Hops[0]
+
+	// Every node data field is an attribute holding the field as in a PTO trace
+	fields := []struct {
+		mask     uint32
+		attrType uint16
+	}{
+		{ioam.TRACE_TYPE_BIT0_MASK, ioam.IOAM6_EVENT_ATTR_DEX_DATA_HOP_LIM_NODE_ID},
+		{ioam.TRACE_TYPE_BIT1_MASK, ioam.IOAM6_EVENT_ATTR_DEX_DATA_INGRESS_EGRESS_INTERFACES},
+		{ioam.TRACE_TYPE_BIT2_MASK, ioam.IOAM6_EVENT_ATTR_DEX_DATA_TIMESTAMP},
+		{ioam.TRACE_TYPE_BIT3_MASK, ioam.IOAM6_EVENT_ATTR_DEX_DATA_TIMESTAMP_FRAC},
+		{ioam.TRACE_TYPE_BIT4_MASK, ioam.IOAM6_EVENT_ATTR_DEX_DATA_TRANSIT},
+		{ioam.TRACE_TYPE_BIT5_MASK, ioam.IOAM6_EVENT_ATTR_DEX_DATA_NAMESPACE_SPECIFIC},
+		{ioam.TRACE_TYPE_BIT6_MASK, ioam.IOAM6_EVENT_ATTR_DEX_DATA_QUEUE_DEPTH},
+		{ioam.TRACE_TYPE_BIT7_MASK, ioam.IOAM6_EVENT_ATTR_DEX_DATA_CHECKSUM},
+		{ioam.TRACE_TYPE_BIT8_MASK, ioam.IOAM6_EVENT_ATTR_DEX_DATA_HOP_LIM_NODE_ID_WIDE},
+		{ioam.TRACE_TYPE_BIT9_MASK, ioam.IOAM6_EVENT_ATTR_DEX_DATA_INGRESS_EGRESS_INTERFACES_WIDE},
+		{ioam.TRACE_TYPE_BIT10_MASK, ioam.IOAM6_EVENT_ATTR_DEX_DATA_NAMESPACE_SPECIFIC_WIDE},
+		{ioam.TRACE_TYPE_BIT11_MASK, ioam.IOAM6_EVENT_ATTR_DEX_DATA_BUFFER_OCCUPANCY},
+		{ioam.TRACE_TYPE_BIT12_MASK, ioam.IOAM6_EVENT_ATTR_DEX_BIT_12},
+	}
+	for bit := range uint16(9) {
+		fields = append(fields, struct {
+			mask     uint32
+			attrType uint16
+		}{ioam.TRACE_TYPE_BIT13_MASK >> bit, ioam.IOAM6_EVENT_ATTR_DEX_BIT_13 + bit})
+	}
+	for _, field := range fields {
+		if trace.TraceType&field.mask != 0 {
+			attrs = append(attrs, netlink.Attribute{Type: field.attrType, Data: ioamtest.NodeData(field.mask, node)})
+		}
+	}
+
+	if trace.TraceType&ioam.TRACE_TYPE_BIT22_MASK != 0 {
+		attrs = append(attrs,
+			netlink.Attribute{Type: ioam.IOAM6_EVENT_ATTR_DEX_OSS_SCID, Data: binary.BigEndian.AppendUint32(nil, node.OssSchema)},
+			netlink.Attribute{Type: ioam.IOAM6_EVENT_ATTR_DEX_OSS_DATA, Data: node.Snapshot})
+	}
+
+	return attrs
+}
@@ -0,0 +1,160 @@
+package ioam
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Parses an Edge-to-Edge option (RFC 9197 section 4.6): the fields of the
+// E2E type follow the header in bit order. The data of undefined bits is
+// ignored.
+func parseE2EOption(data []byte) (IoamTrace, error) {
+	if len(data) < IOAM6_E2E_HEADER_LEN {
+		return IoamTrace{}, fmt.Errorf("%w: E2E option of %d bytes", ErrTruncatedNode, len(data))
+	}
+
+	trace := IoamTrace{
+		Namespace:  binary.BigEndian.Uint16(data[0:2]),
+		OptionType: IOAM6_OPTION_TYPE_E2E,
+		E2EType:    binary.BigEndian.Uint16(data[2:4]),
+	}
+	fields := data[IOAM6_E2E_HEADER_LEN:]
+	need := 0
+	for _, f := range []struct {
+		mask uint16
+		size int
+	}{{E2E_TYPE_BIT0_MASK, 8}, {E2E_TYPE_BIT1_MASK, 4}, {E2E_TYPE_BIT2_MASK, 4}, {E2E_TYPE_BIT3_MASK, 4}} {
+		if trace.E2EType&f.mask != 0 {
+			need += f.size
+		}
+	}
+	if len(fields) < need {
+		return IoamTrace{}, fmt.Errorf("%w: E2E data of %d bytes, want %d", ErrTruncatedNode, len(fields), need)
+	}
+
+	if trace.E2EType&E2E_TYPE_BIT0_MASK != 0 {
+		trace.E2ESeqNum, fields = binary.BigEndian.Uint64(fields[0:8]), fields[8:]
+	}
+	if trace.E2EType&E2E_TYPE_BIT1_MASK != 0 {
+		trace.E2ESeqNum32, fields = binary.BigEndian.Uint32(fields[0:4]), fields[4:]
+	}
+	if trace.E2EType&E2E_TYPE_BIT2_MASK != 0 {
+		trace.E2ETimestampSecs, fields = binary.BigEndian.Uint32(fields[0:4]), fields[4:]
+	}
+	if trace.E2EType&E2E_TYPE_BIT3_MASK != 0 {
+		trace.E2ETimestampFrac = binary.BigEndian.Uint32(fields[0:4])
+	}
+
+	return trace, nil
+}
+
+// Loss, reordering and duplication counters of the E2E sequence numbers of
+// a namespace
+type E2ECounters struct {
+	Received   uint64
+	Lost       uint64 // gaps in the sequence, minus the late packets
+	Reordered  uint64 // late packets
+	Duplicates uint64 // sequence numbers received twice, or too late to be told apart
+
+	started bool
+	next    uint64              // expected sequence number
+	missing map[uint64]struct{} // recent gaps in the sequence
+}
+
+// Per-namespace E2E counters, assuming a single sequence per namespace. The
+// zero value is ready to use.
+type E2ETracker struct {
+	mu         sync.Mutex
+	namespaces map[uint16]*E2ECounters
+}
+
+// Accounts the sequence number of an E2E option, the 64-bit one if both
+// are present. Options without sequence number are ignored.
+func (t *E2ETracker) Observe(trace IoamTrace) {
+	var seqNum uint64
+	wide := trace.E2EType&E2E_TYPE_BIT0_MASK != 0
+	switch {
+	case wide:
+		seqNum = trace.E2ESeqNum
+	case trace.E2EType&E2E_TYPE_BIT1_MASK != 0:
+		seqNum = uint64(trace.E2ESeqNum32)
+	default:
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.namespaces == nil {
+		t.namespaces = make(map[uint16]*E2ECounters)
+	}
+	c, ok := t.namespaces[trace.Namespace]
+	if !ok {
+		c = &E2ECounters{}
+		t.namespaces[trace.Namespace] = c
+	}
+	c.Received++
+
+	// Serial number arithmetic, so that the sequence can wrap
+	distance := func(a, b uint64) int64 {
+		if wide {
+			return int64(a - b)
+		}
+		return int64(int32(uint32(a) - uint32(b)))
+	}
+	diff := distance(seqNum, c.next)
+	switch {
+	case !c.started || diff == 0:
+		c.started = true
+	case diff > 0:
+		c.Lost += uint64(diff)
+		if c.missing == nil {
+			c.missing = make(map[uint64]struct{})
+		}
+		for s := range c.missing {
+			if distance(seqNum, s) > E2E_REORDER_WINDOW {
+				delete(c.missing, s)
+			}
+		}
+		for i := max(0, diff-E2E_REORDER_WINDOW); i < diff; i++ {
+			s := c.next + uint64(i)
+			if !wide {
+				s = uint64(uint32(s))
+			}
+			c.missing[s] = struct{}{}
+		}
+	default:
+		// Only a missing sequence number can come late
+		if _, ok := c.missing[seqNum]; ok {
+			delete(c.missing, seqNum)
+			c.Reordered++
+			c.Lost--
+		} else {
+			c.Duplicates++
+		}
+		return
+	}
+	c.next = seqNum + 1
+	if !wide {
+		c.next = uint64(uint32(c.next))
+	}
+}
+
+// Returns a copy of the counters of every namespace, sorted by namespace
+func (t *E2ETracker) Snapshot() ([]uint16, []E2ECounters) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	namespaces := make([]uint16, 0, len(t.namespaces))
+	for ns := range t.namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	slices.Sort(namespaces)
+	counters := make([]E2ECounters, len(namespaces))
+	for i, ns := range namespaces {
+		counters[i] = *t.namespaces[ns]
+		counters[i].missing = nil
+	}
+	return namespaces, counters
+}
@@ -0,0 +1,44 @@
+package ioam_test
+
+import (
+	"testing"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+)
+
+func TestE2ETracker(t *testing.T) {
+	var tracker ioam.E2ETracker
+	observe := func(namespace uint16, seqNums ...uint64) {
+		for _, seqNum := range seqNums {
+			tracker.Observe(ioam.IoamTrace{Namespace: namespace, OptionType: ioam.IOAM6_OPTION_TYPE_E2E,
+				E2EType: ioam.E2E_TYPE_BIT0_MASK, E2ESeqNum: seqNum})
+		}
+	}
+	// 14 is lost, 13 comes late, then 16 and 13 are duplicated
+	observe(1, 10, 11, 12, 15, 16, 13, 17, 16, 13)
+	// 32-bit sequence numbers wrap
+	for _, seqNum := range []uint32{0xFFFFFFFE, 0xFFFFFFFF, 0, 2} {
+		tracker.Observe(ioam.IoamTrace{Namespace: 2, OptionType: ioam.IOAM6_OPTION_TYPE_E2E,
+			E2EType: ioam.E2E_TYPE_BIT1_MASK, E2ESeqNum32: seqNum})
+	}
+	// Duplicates before any gap do not count as late
+	observe(4, 1, 1, 2, 2)
+	// Without sequence number
+	tracker.Observe(ioam.IoamTrace{Namespace: 3, OptionType: ioam.IOAM6_OPTION_TYPE_E2E, E2EType: ioam.E2E_TYPE_BIT2_MASK})
+
+	namespaces, counters := tracker.Snapshot()
+	if len(namespaces) != 3 || namespaces[0] != 1 || namespaces[1] != 2 || namespaces[2] != 4 {
+		t.Fatalf("namespaces %v, want [1 2 4]", namespaces)
+	}
+	for i, want := range []ioam.E2ECounters{
+		{Received: 9, Lost: 1, Reordered: 1, Duplicates: 2},
+		{Received: 4, Lost: 1},
+		{Received: 4, Duplicates: 2},
+	} {
+		got := counters[i]
+		if got.Received != want.Received || got.Lost != want.Lost || got.Reordered != want.Reordered || got.Duplicates != want.Duplicates {
+			t.Errorf("namespace %d: received %d, lost %d, reordered %d, duplicates %d, want %d, %d, %d, %d", namespaces[i],
+				got.Received, got.Lost, got.Reordered, got.Duplicates, want.Received, want.Lost, want.Reordered, want.Duplicates)
+		}
+	}
+}
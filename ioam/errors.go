@@ -0,0 +1,42 @@
+package ioam
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mdlayher/netlink"
+)
+
+// Errors returned by the IOAM decoders
+var (
+	ErrBadAttributes      = errors.New("malformed netlink attributes")
+	ErrUnknownCommand     = errors.New("unknown generic netlink command")
+	ErrTruncatedAttribute = errors.New("truncated attribute")
+	ErrBadNodeLen         = errors.New("node length does not match trace type")
+	ErrTruncatedNode      = errors.New("truncated node data")
+	ErrTruncatedSnapshot  = errors.New("truncated opaque state snapshot")
+	ErrSnapshotTooLong    = errors.New("opaque state snapshot longer than the maximum")
+	ErrTraceTooLong       = errors.New("trace data longer than the maximum")
+	ErrUnknownOptionType  = errors.New("unknown IOAM option type")
+)
+
+// Error classes counted separately in the stats, in display order
+var ErrorClasses = []error{
+	ErrBadAttributes,
+	ErrUnknownCommand,
+	ErrTruncatedAttribute,
+	ErrBadNodeLen,
+	ErrTruncatedNode,
+	ErrTruncatedSnapshot,
+	ErrSnapshotTooLong,
+	ErrTraceTooLong,
+	ErrUnknownOptionType,
+}
+
+// Checks that a netlink attribute holds at least minLen bytes
+func checkAttrLen(attr netlink.Attribute, minLen int) error {
+	if len(attr.Data) < minLen {
+		return fmt.Errorf("%w: attribute %d has %d bytes, want %d", ErrTruncatedAttribute, attr.Type, len(attr.Data), minLen)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package ioam
+
+import (
+	"fmt"
+
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+)
+
+// Parses an IOAM6 generic netlink event of the kernel, a trace or a DEX event
+func ReadMessage(msg genetlink.Message) (IoamTrace, error) {
+	attrs, err := netlink.UnmarshalAttributes(msg.Data)
+	if err != nil {
+		return IoamTrace{}, fmt.Errorf("%w: %v", ErrBadAttributes, err)
+	}
+
+	switch msg.Header.Command {
+	case IOAM6_EVENT_TYPE_TRACE:
+		return ExtractPtoData(attrs)
+	case IOAM6_EVENT_TYPE_DEX:
+		return ExtractDexData(attrs)
+	}
+
+	return IoamTrace{}, fmt.Errorf("%w: %d", ErrUnknownCommand, msg.Header.Command)
+}
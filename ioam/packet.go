@@ -0,0 +1,255 @@
+package ioam
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the packet decoder
+var (
+	ErrNotIPv6          = errors.New("not an IPv6 packet")
+	ErrTruncatedPacket  = errors.New("truncated packet")
+	ErrUnknownLinkType  = errors.New("unsupported link type")
+	ErrTruncatedOptions = errors.New("truncated IPv6 options")
+)
+
+// Header of an IOAM trace option (RFC 9197 section 4.4)
+type ioamTraceHeader struct {
+	namespace uint16
+	traceType uint32
+	TraceHeader
+}
+
+// Extracts the IOAM traces of a captured packet. Every IOAM option of the
+// Hop-by-Hop and Destination Options headers of the IPv6 packet, and of
+// encapsulated IPv6 packets, gives a trace.
+func ExtractPacketTraces(linkType uint16, data []byte) ([]IoamTrace, error) {
+	packet, err := ipv6Payload(linkType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var traces []IoamTrace
+	for depth := 0; depth < IPV6_MAX_ENCAPSULATION; depth++ {
+		if len(packet) < IPV6_HEADER_LEN {
+			return traces, ErrTruncatedPacket
+		}
+		if packet[0]>>4 != 6 {
+			return traces, ErrNotIPv6
+		}
+
+		next := packet[6]
+		headers := packet[IPV6_HEADER_LEN:]
+		for {
+			var length int
+			switch next {
+			case IPPROTO_HOPOPTS, IPPROTO_DSTOPTS, IPPROTO_ROUTING:
+				if len(headers) < 2 {
+					return traces, ErrTruncatedPacket
+				}
+				length = (int(headers[1]) + 1) * 8
+			case IPPROTO_FRAGMENT:
+				length = 8
+			case IPPROTO_AH:
+				if len(headers) < 2 {
+					return traces, ErrTruncatedPacket
+				}
+				length = (int(headers[1]) + 2) * 4
+			case IPPROTO_IPV6:
+				// IOAM encapsulation: the inner packet may carry options too
+				packet = headers
+			default:
+				// Upper-layer protocol or no next header
+				return traces, nil
+			}
+			if next == IPPROTO_IPV6 {
+				break
+			}
+			if len(headers) < length {
+				return traces, ErrTruncatedPacket
+			}
+
+			if next == IPPROTO_HOPOPTS || next == IPPROTO_DSTOPTS {
+				found, err := extractOptionTraces(headers[2:length])
+				traces = append(traces, found...)
+				if err != nil {
+					return traces, err
+				}
+			}
+			next, headers = headers[0], headers[length:]
+		}
+	}
+
+	return traces, nil
+}
+
+// Strips the link-layer header of a packet
+func ipv6Payload(linkType uint16, data []byte) ([]byte, error) {
+	switch linkType {
+	case LINKTYPE_NULL:
+		// Address family in host byte order: 24, 28 or 30 for IPv6
+		if len(data) < 4 {
+			return nil, ErrTruncatedPacket
+		}
+		family := binary.LittleEndian.Uint32(data[0:4])
+		if family > 0xFFFF {
+			family = binary.BigEndian.Uint32(data[0:4])
+		}
+		if family != 24 && family != 28 && family != 30 {
+			return nil, ErrNotIPv6
+		}
+		return data[4:], nil
+	case LINKTYPE_ETHERNET:
+		if len(data) < 14 {
+			return nil, ErrTruncatedPacket
+		}
+		etherType, offset := binary.BigEndian.Uint16(data[12:14]), 14
+		// VLAN tags
+		for etherType == ETHERTYPE_VLAN || etherType == ETHERTYPE_QINQ {
+			if len(data) < offset+4 {
+				return nil, ErrTruncatedPacket
+			}
+			etherType, offset = binary.BigEndian.Uint16(data[offset+2:offset+4]), offset+4
+		}
+		if etherType != ETHERTYPE_IPV6 {
+			return nil, ErrNotIPv6
+		}
+		return data[offset:], nil
+	case LINKTYPE_RAW, LINKTYPE_IPV6, DLT_RAW:
+		return data, nil
+	case LINKTYPE_LINUX_SLL:
+		if len(data) < 16 {
+			return nil, ErrTruncatedPacket
+		}
+		if binary.BigEndian.Uint16(data[14:16]) != ETHERTYPE_IPV6 {
+			return nil, ErrNotIPv6
+		}
+		return data[16:], nil
+	case LINKTYPE_LINUX_SLL2:
+		if len(data) < 20 {
+			return nil, ErrTruncatedPacket
+		}
+		if binary.BigEndian.Uint16(data[0:2]) != ETHERTYPE_IPV6 {
+			return nil, ErrNotIPv6
+		}
+		return data[20:], nil
+	}
+
+	return nil, fmt.Errorf("%w: %d", ErrUnknownLinkType, linkType)
+}
+
+// Extracts the traces of the IOAM options of a Hop-by-Hop or Destination
+// Options header (RFC 9486 section 3)
+func extractOptionTraces(options []byte) ([]IoamTrace, error) {
+	var traces []IoamTrace
+
+	for len(options) > 0 {
+		if options[0] == IPV6_OPT_PAD1 {
+			options = options[1:]
+			continue
+		}
+		if len(options) < 2 || len(options) < 2+int(options[1]) {
+			return traces, ErrTruncatedOptions
+		}
+		optType, data := options[0], options[2:2+int(options[1])]
+		options = options[2+int(options[1]):]
+		if optType != IPV6_OPT_IOAM {
+			continue
+		}
+
+		// Reserved and IOAM option type
+		if len(data) < 2 {
+			return traces, fmt.Errorf("%w: IOAM option of %d bytes", ErrTruncatedNode, len(data))
+		}
+		trace, err := ParseIoamOption(data[1], data[2:])
+		if err != nil {
+			return traces, err
+		}
+		traces = append(traces, trace)
+	}
+
+	return traces, nil
+}
+
+// Parses the data of an IOAM option of the given type
+func ParseIoamOption(optionType uint8, data []byte) (IoamTrace, error) {
+	switch optionType {
+	case IOAM6_OPTION_TYPE_PREALLOC, IOAM6_OPTION_TYPE_INCREMENTAL:
+		header, err := parseTraceHeader(data)
+		if err != nil {
+			return IoamTrace{}, err
+		}
+		nodes := data[IOAM6_TRACE_HEADER_LEN:]
+		if optionType == IOAM6_OPTION_TYPE_PREALLOC {
+			// The free space comes before the recorded nodes
+			if len(nodes) < int(header.RemainingLen)*4 {
+				return IoamTrace{}, fmt.Errorf("%w: RemainingLen %d beyond the option", ErrTruncatedNode, header.RemainingLen)
+			}
+			nodes = nodes[int(header.RemainingLen)*4:]
+		}
+		return parsePtoTrace(optionType, header, nodes)
+	case IOAM6_OPTION_TYPE_DEX:
+		// The encapsulating node only requests the export, it adds no data
+		trace, _, err := parseDexOption(data)
+		return trace, err
+	case IOAM6_OPTION_TYPE_POT:
+		return parsePotOption(data)
+	case IOAM6_OPTION_TYPE_E2E:
+		return parseE2EOption(data)
+	}
+
+	return IoamTrace{}, fmt.Errorf("%w: %d", ErrUnknownOptionType, optionType)
+}
+
+// Parses the header of a pre-allocated or incremental trace option
+func parseTraceHeader(data []byte) (ioamTraceHeader, error) {
+	if len(data) < IOAM6_TRACE_HEADER_LEN {
+		return ioamTraceHeader{}, fmt.Errorf("%w: trace header of %d bytes", ErrTruncatedNode, len(data))
+	}
+
+	lengths := binary.BigEndian.Uint16(data[2:4])
+	return ioamTraceHeader{
+		namespace: binary.BigEndian.Uint16(data[0:2]),
+		traceType: binary.BigEndian.Uint32(data[4:8]) >> 8,
+		TraceHeader: TraceHeader{
+			NodeLen:      uint8(lengths >> 11),
+			Flags:        uint8(lengths>>7) & 0x0F,
+			RemainingLen: uint8(lengths) & 0x7F,
+		},
+	}, nil
+}
+
+// Parses a DEX option (RFC 9326 section 3.2). The option only requests the
+// nodes to export their data, so the trace holds the namespace, the requested
+// trace type, the flow ID and the sequence number, without hops. Returns the
+// bytes following the optional fields.
+func parseDexOption(data []byte) (IoamTrace, []byte, error) {
+	if len(data) < IOAM6_DEX_HEADER_LEN {
+		return IoamTrace{}, nil, fmt.Errorf("%w: DEX option of %d bytes", ErrTruncatedNode, len(data))
+	}
+
+	trace := IoamTrace{
+		Namespace:  binary.BigEndian.Uint16(data[0:2]),
+		TraceType:  binary.BigEndian.Uint32(data[4:8]) >> 8,
+		OptionType: IOAM6_OPTION_TYPE_DEX,
+	}
+	extFlags := data[3]
+	fields := data[IOAM6_DEX_HEADER_LEN:]
+	if extFlags&IOAM6_DEX_EXT_FLOW_ID != 0 {
+		if len(fields) < 4 {
+			return IoamTrace{}, nil, fmt.Errorf("%w: missing DEX flow ID", ErrTruncatedNode)
+		}
+		trace.DexFlowID, trace.HasDexFlowID = binary.BigEndian.Uint32(fields[0:4]), true
+		fields = fields[4:]
+	}
+	if extFlags&IOAM6_DEX_EXT_SEQ_NUM != 0 {
+		if len(fields) < 4 {
+			return IoamTrace{}, nil, fmt.Errorf("%w: missing DEX sequence number", ErrTruncatedNode)
+		}
+		trace.DexSeqNum, trace.HasDexSeqNum = binary.BigEndian.Uint32(fields[0:4]), true
+		fields = fields[4:]
+	}
+
+	return trace, fields, nil
+}
@@ -0,0 +1,115 @@
+package ioam_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/Advanced-Observability/ioam-exporter/internal/ioamtest"
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+)
+
+func TestExtractPacketTraces(t *testing.T) {
+	const traceType = 0xF08002
+	nodes := []ioam.IoamNode{ioamtest.Node(traceType, 1), ioamtest.Node(traceType, 2)}
+	header := ioam.TraceHeader{NodeLen: uint8(ioam.PtoNodeLen(traceType))}
+	preallocated := ioamtest.Trace(traceType, ioam.IOAM6_OPTION_TYPE_PREALLOC, header, nodes...)
+	firstHop := ioamtest.Trace(traceType, ioam.IOAM6_OPTION_TYPE_PREALLOC, header, nodes[0])
+	incremental := ioamtest.Trace(traceType, ioam.IOAM6_OPTION_TYPE_INCREMENTAL, header, nodes...)
+	header.RemainingLen = 3
+	withFreeSpace := ioamtest.Trace(traceType, ioam.IOAM6_OPTION_TYPE_PREALLOC, header, nodes...)
+	overflow := ioamtest.TraceOption(0, preallocated)
+	binary.BigEndian.PutUint16(overflow[4:6], binary.BigEndian.Uint16(overflow[4:6])|ioam.IOAM6_TRACE_FLAG_OVERFLOW<<7)
+	header = ioam.TraceHeader{NodeLen: header.NodeLen, Flags: ioam.IOAM6_TRACE_FLAG_OVERFLOW}
+	overflowed := ioamtest.Trace(traceType, ioam.IOAM6_OPTION_TYPE_PREALLOC, header, nodes...)
+	dex := []byte{0, ioam.IOAM6_OPTION_TYPE_DEX, 0, 123, 0, ioam.IOAM6_DEX_EXT_FLOW_ID | ioam.IOAM6_DEX_EXT_SEQ_NUM, 0xF0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0, 8}
+	pot := []byte{0, ioam.IOAM6_OPTION_TYPE_POT, 0, 123, ioam.IOAM6_POT_TYPE_0, 0}
+	pot = binary.BigEndian.AppendUint64(pot, 0x0102030405060708)
+	pot = binary.BigEndian.AppendUint64(pot, 0x1112131415161718)
+	e2e := []byte{0, ioam.IOAM6_OPTION_TYPE_E2E, 0, 123, 0xB0, 0} // bits 0, 2 and 3
+	e2e = binary.BigEndian.AppendUint64(e2e, 1<<40)
+	e2e = binary.BigEndian.AppendUint32(e2e, 1700000000)
+	e2e = binary.BigEndian.AppendUint32(e2e, 500)
+	udp := make([]byte, 8)
+
+	for _, tt := range []struct {
+		name     string
+		linkType uint16
+		data     []byte
+		want     []ioam.IoamTrace
+		err      error
+	}{
+		{"pre-allocated", ioam.LINKTYPE_ETHERNET,
+			ioamtest.EthernetFrame(ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, append(ioamtest.OptionsHeader(17, ioamtest.TraceOption(3, preallocated)), udp...))),
+			[]ioam.IoamTrace{withFreeSpace}, nil},
+		{"overflow", ioam.LINKTYPE_RAW,
+			ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(59, overflow)),
+			[]ioam.IoamTrace{overflowed}, nil},
+		{"incremental", ioam.LINKTYPE_RAW,
+			ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(59, ioamtest.TraceOption(0, incremental))),
+			[]ioam.IoamTrace{incremental}, nil},
+		{"DEX", ioam.LINKTYPE_RAW,
+			ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(59, dex)),
+			[]ioam.IoamTrace{{Namespace: 123, OptionType: ioam.IOAM6_OPTION_TYPE_DEX, TraceType: 0xF00000, DexFlowID: 7, DexSeqNum: 8, HasDexFlowID: true, HasDexSeqNum: true}}, nil},
+		{"POT", ioam.LINKTYPE_RAW,
+			ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(59, pot)),
+			[]ioam.IoamTrace{{Namespace: 123, OptionType: ioam.IOAM6_OPTION_TYPE_POT, PotRandom: 0x0102030405060708, PotCumulative: 0x1112131415161718}}, nil},
+		{"E2E", ioam.LINKTYPE_RAW,
+			ioamtest.IPv6Packet(ioam.IPPROTO_DSTOPTS, ioamtest.OptionsHeader(59, e2e)),
+			[]ioam.IoamTrace{{Namespace: 123, OptionType: ioam.IOAM6_OPTION_TYPE_E2E, E2EType: 0xB000,
+				E2ESeqNum: 1 << 40, E2ETimestampSecs: 1700000000, E2ETimestampFrac: 500}}, nil},
+		{"encapsulated", ioam.LINKTYPE_RAW,
+			ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, append(ioamtest.OptionsHeader(ioam.IPPROTO_IPV6, ioamtest.TraceOption(0, firstHop)),
+				ioamtest.IPv6Packet(ioam.IPPROTO_DSTOPTS, ioamtest.OptionsHeader(59, ioamtest.TraceOption(0, preallocated)))...)),
+			[]ioam.IoamTrace{firstHop, preallocated}, nil},
+		{"no IOAM", ioam.LINKTYPE_RAW, ioamtest.IPv6Packet(17, udp), nil, nil},
+		{"IPv4", ioam.LINKTYPE_ETHERNET, append(make([]byte, 12), 0x08, 0x00), nil, ioam.ErrNotIPv6},
+		{"unknown option type", ioam.LINKTYPE_RAW,
+			ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(59, []byte{0, 5, 0, 0})), nil, ioam.ErrUnknownOptionType},
+		{"unknown POT type", ioam.LINKTYPE_RAW,
+			ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(59, append([]byte{0, ioam.IOAM6_OPTION_TYPE_POT, 0, 123, 1}, pot[5:]...))), nil, ioam.ErrUnknownOptionType},
+		{"truncated POT", ioam.LINKTYPE_RAW,
+			ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(59, pot[:len(pot)-1])), nil, ioam.ErrTruncatedNode},
+		{"truncated E2E", ioam.LINKTYPE_RAW,
+			ioamtest.IPv6Packet(ioam.IPPROTO_DSTOPTS, ioamtest.OptionsHeader(59, e2e[:len(e2e)-4])), nil, ioam.ErrTruncatedNode},
+		{"RemainingLen beyond the option", ioam.LINKTYPE_RAW,
+			ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(59, ioamtest.TraceOption(5, preallocated)[:10])), nil, ioam.ErrTruncatedNode},
+		{"truncated header", ioam.LINKTYPE_RAW, ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, []byte{59, 1, 0, 0}), nil, ioam.ErrTruncatedPacket},
+		{"unknown link type", 1000, nil, nil, ioam.ErrUnknownLinkType},
+	} {
+		traces, err := ioam.ExtractPacketTraces(tt.linkType, tt.data)
+		if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+		}
+		if len(traces) != len(tt.want) {
+			t.Errorf("%s: %d traces, want %d", tt.name, len(traces), len(tt.want))
+			continue
+		}
+		for i := range traces {
+			if !ioamtest.EqualTraces(traces[i], tt.want[i]) {
+				t.Errorf("%s: trace %d\ngot  %+v\nwant %+v", tt.name, i, traces[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func FuzzExtractPacketTraces(f *testing.F) {
+	trace := ioamtest.Trace(0xF08002, ioam.IOAM6_OPTION_TYPE_PREALLOC, ioam.TraceHeader{}, ioamtest.Node(0xF08002, 1))
+	f.Add(uint16(ioam.LINKTYPE_RAW), ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(59, ioamtest.TraceOption(2, trace))))
+	trace.OptionType = ioam.IOAM6_OPTION_TYPE_INCREMENTAL
+	f.Add(uint16(ioam.LINKTYPE_ETHERNET), ioamtest.EthernetFrame(ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(ioam.IPPROTO_IPV6,
+		ioamtest.TraceOption(0, trace)))))
+	f.Add(uint16(ioam.LINKTYPE_RAW), ioamtest.IPv6Packet(ioam.IPPROTO_DSTOPTS, ioamtest.OptionsHeader(59,
+		append([]byte{0, ioam.IOAM6_OPTION_TYPE_E2E, 0, 1, 0xF0, 0}, make([]byte, 20)...))))
+	f.Add(uint16(ioam.LINKTYPE_RAW), ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(59,
+		append([]byte{0, ioam.IOAM6_OPTION_TYPE_POT, 0, 1, ioam.IOAM6_POT_TYPE_0, 0}, make([]byte, 16)...))))
+
+	f.Fuzz(func(t *testing.T, linkType uint16, data []byte) {
+		traces, _ := ioam.ExtractPacketTraces(linkType, data)
+		for _, trace := range traces {
+			if trace.TraceType > 0xFFFFFF {
+				t.Fatalf("trace type %#x longer than 24 bits", trace.TraceType)
+			}
+		}
+	})
+}
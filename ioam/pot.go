@@ -0,0 +1,31 @@
+package ioam
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Parses a Proof-of-Transit option (RFC 9197 section 4.5). Only POT type 0,
+// a random number and a cumulative value, is defined.
+func parsePotOption(data []byte) (IoamTrace, error) {
+	if len(data) < IOAM6_POT_HEADER_LEN {
+		return IoamTrace{}, fmt.Errorf("%w: POT option of %d bytes", ErrTruncatedNode, len(data))
+	}
+
+	trace := IoamTrace{
+		Namespace:  binary.BigEndian.Uint16(data[0:2]),
+		OptionType: IOAM6_OPTION_TYPE_POT,
+		PotType:    data[2],
+	}
+	if trace.PotType != IOAM6_POT_TYPE_0 {
+		return IoamTrace{}, fmt.Errorf("%w: POT type %d", ErrUnknownOptionType, trace.PotType)
+	}
+	fields := data[IOAM6_POT_HEADER_LEN:]
+	if len(fields) < IOAM6_POT_TYPE_0_LEN {
+		return IoamTrace{}, fmt.Errorf("%w: POT data of %d bytes", ErrTruncatedNode, len(fields))
+	}
+	trace.PotRandom = binary.BigEndian.Uint64(fields[0:8])
+	trace.PotCumulative = binary.BigEndian.Uint64(fields[8:16])
+
+	return trace, nil
+}
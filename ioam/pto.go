@@ -0,0 +1,203 @@
+package ioam
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"slices"
+
+	"github.com/mdlayher/netlink"
+)
+
+// Minimum length of the PTO netlink attributes
+var ptoAttrLen = map[uint16]int{
+	IOAM6_EVENT_ATTR_TRACE_NAMESPACE: 2,
+	IOAM6_EVENT_ATTR_TRACE_NODELEN:   1,
+	IOAM6_EVENT_ATTR_TRACE_TYPE:      4,
+	IOAM6_EVENT_ATTR_OPTION_TYPE:     1,
+	IOAM6_EVENT_ATTR_TRACE_FLAGS:     1,
+	IOAM6_EVENT_ATTR_TRACE_REMLEN:    1,
+}
+
+// Parses the netlink attributes of a trace event, pre-allocated unless the
+// option type attribute says incremental. The flags and RemainingLen are
+// only known when the kernel reports them.
+func ExtractPtoData(attrs []netlink.Attribute) (IoamTrace, error) {
+	var header ioamTraceHeader
+	var data []byte
+	var optionType uint8 = IOAM6_OPTION_TYPE_PREALLOC
+
+	for _, attr := range attrs {
+		if err := checkAttrLen(attr, ptoAttrLen[attr.Type]); err != nil {
+			return IoamTrace{}, err
+		}
+
+		switch attr.Type {
+		case IOAM6_EVENT_ATTR_TRACE_NAMESPACE:
+			header.namespace = binary.LittleEndian.Uint16(attr.Data)
+		case IOAM6_EVENT_ATTR_TRACE_NODELEN:
+			header.NodeLen = attr.Data[0]
+		case IOAM6_EVENT_ATTR_TRACE_TYPE:
+			header.traceType = binary.LittleEndian.Uint32(attr.Data) >> 8
+		case IOAM6_EVENT_ATTR_TRACE_DATA:
+			data = attr.Data
+		case IOAM6_EVENT_ATTR_OPTION_TYPE:
+			optionType = attr.Data[0]
+			if optionType != IOAM6_OPTION_TYPE_PREALLOC && optionType != IOAM6_OPTION_TYPE_INCREMENTAL {
+				return IoamTrace{}, fmt.Errorf("%w: %d in trace event", ErrUnknownOptionType, optionType)
+			}
+		case IOAM6_EVENT_ATTR_TRACE_FLAGS:
+			header.Flags = attr.Data[0] & 0x0F
+		case IOAM6_EVENT_ATTR_TRACE_REMLEN:
+			header.RemainingLen = attr.Data[0] & 0x7F
+		}
+	}
+
+	return parsePtoTrace(optionType, header, data)
+}
+
+// Parses the node data list of a pre-allocated or incremental trace. Both
+// option types hold the most recent node first (RFC 9197 section 4.4): the
+// nodes are returned in path order, the encapsulating node first.
+func parsePtoTrace(optionType uint8, header ioamTraceHeader, data []byte) (IoamTrace, error) {
+	nodeLen, traceType := header.NodeLen, header.traceType
+	if len(data) > IOAM6_TRACE_DATA_SIZE_MAX {
+		return IoamTrace{}, fmt.Errorf("%w: %d bytes", ErrTraceTooLong, len(data))
+	}
+	// NodeLen is fully determined by the trace type. Checking it also
+	// guarantees that every node makes progress below, nodes without
+	// data having at least an opaque state snapshot header.
+	if int(nodeLen) != PtoNodeLen(traceType) {
+		return IoamTrace{}, fmt.Errorf("%w: NodeLen %d, trace type %#06x needs %d", ErrBadNodeLen, nodeLen, traceType, PtoNodeLen(traceType))
+	}
+	if nodeLen == 0 && traceType&TRACE_TYPE_BIT22_MASK == 0 && len(data) > 0 {
+		return IoamTrace{}, fmt.Errorf("%w: no field in trace type %#06x", ErrBadNodeLen, traceType)
+	}
+
+	trace := IoamTrace{
+		OptionType: optionType,
+		Namespace:  header.namespace,
+		TraceType:  traceType,
+		Header:     header.TraceHeader,
+	}
+	for offset := 0; offset < len(data); {
+		node, n, err := parseTraceNode(data[offset:], traceType)
+		if err != nil {
+			return IoamTrace{}, fmt.Errorf("node %d at offset %d: %w", len(trace.Hops), offset, err)
+		}
+		trace.Hops = append(trace.Hops, node)
+		offset += n
+	}
+	slices.Reverse(trace.Hops)
+
+	return trace, nil
+}
+
+// Parses the data of a node and its opaque state snapshot, as laid out in
+// traces and DEX exports, and returns the number of bytes used
+func parseTraceNode(data []byte, traceType uint32) (IoamNode, int, error) {
+	size := PtoNodeLen(traceType) * 4
+	if len(data) < size {
+		return IoamNode{}, 0, fmt.Errorf("%w: %d bytes, trace type %#06x needs %d", ErrTruncatedNode, len(data), traceType, size)
+	}
+	node, err := parseIoamPtoNode(data[:size], traceType)
+	if err != nil {
+		return IoamNode{}, 0, err
+	}
+
+	if traceType&TRACE_TYPE_BIT22_MASK != 0 {
+		if len(data)-size < 4 {
+			return IoamNode{}, 0, fmt.Errorf("%w: missing snapshot header", ErrTruncatedSnapshot)
+		}
+		node.OssLen = data[size]
+		if node.OssLen == 0 {
+			return node, size + 4, nil
+		}
+
+		node.OssSchema = binary.BigEndian.Uint32(data[size:size+4]) & 0xFFFFFF
+
+		if len(data)-size < 4+int(node.OssLen)*4 {
+			return IoamNode{}, 0, fmt.Errorf("%w: %d bytes, OSS length %d", ErrTruncatedSnapshot, len(data)-size-4, node.OssLen)
+		}
+		node.Snapshot = data[4+size : 4+size+int(node.OssLen)*4]
+		size += 4 + int(node.OssLen)*4
+	}
+
+	return node, size, nil
+}
+
+// Length in 4-octet units of the node data for the given trace type,
+// excluding the opaque state snapshot (RFC 9197 section 4.4)
+func PtoNodeLen(traceType uint32) int {
+	// Bits 0 to 21, bit 22 (OSS) and 23 (reserved) excluded
+	fields := traceType & 0xFFFFFC
+
+	return bits.OnesCount32(fields&^TRACE_TYPE_WIDE_MASK) + 2*bits.OnesCount32(fields&TRACE_TYPE_WIDE_MASK)
+}
+
+// Parses the fixed-length fields of a node for the given trace type
+func parseIoamPtoNode(data []byte, traceType uint32) (IoamNode, error) {
+	node := IoamNode{}
+	offset := 0
+
+	if len(data) < PtoNodeLen(traceType)*4 {
+		return node, fmt.Errorf("%w: %d bytes, trace type %#06x needs %d", ErrTruncatedNode, len(data), traceType, PtoNodeLen(traceType)*4)
+	}
+
+	if traceType&TRACE_TYPE_BIT0_MASK != 0 {
+		node.HopLimit = data[offset]
+		node.NodeId = binary.BigEndian.Uint32(data[offset:offset+4]) & 0xFFFFFF
+		offset += 4
+	}
+	if traceType&TRACE_TYPE_BIT1_MASK != 0 {
+		node.IngressId = uint16(binary.BigEndian.Uint16(data[offset : offset+2]))
+		node.EgressId = uint16(binary.BigEndian.Uint16(data[offset+2 : offset+4]))
+		offset += 4
+	}
+	if traceType&TRACE_TYPE_BIT2_MASK != 0 {
+		node.TimestampSecs = binary.BigEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
+	if traceType&TRACE_TYPE_BIT3_MASK != 0 {
+		node.TimestampFrac = binary.BigEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
+	if traceType&TRACE_TYPE_BIT4_MASK != 0 {
+		node.TransitDelay = binary.BigEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
+	if traceType&TRACE_TYPE_BIT5_MASK != 0 {
+		node.NamespaceData = binary.BigEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
+	if traceType&TRACE_TYPE_BIT6_MASK != 0 {
+		node.QueueDepth = binary.BigEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
+	if traceType&TRACE_TYPE_BIT7_MASK != 0 {
+		node.ChecksumComplement = binary.BigEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
+	if traceType&TRACE_TYPE_BIT8_MASK != 0 {
+		node.HopLimit = data[offset]
+		node.NodeIdWide = binary.BigEndian.Uint64(data[offset:offset+8]) & 0xFFFFFFFFFFFFFF
+		offset += 8
+	}
+	if traceType&TRACE_TYPE_BIT9_MASK != 0 {
+		node.IngressIdWide = binary.BigEndian.Uint32(data[offset : offset+4])
+		node.EgressIdWide = binary.BigEndian.Uint32(data[offset+4 : offset+8])
+		offset += 8
+	}
+	if traceType&TRACE_TYPE_BIT10_MASK != 0 {
+		node.NamespaceDataWide = binary.BigEndian.Uint64(data[offset : offset+8])
+		offset += 8
+	}
+	if traceType&TRACE_TYPE_BIT11_MASK != 0 {
+		node.BufferOccupancy = binary.BigEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
+	// Undefined fields follow, they carry no information and their 4 bytes
+	// each are counted by PtoNodeLen
+
+	return node, nil
+}
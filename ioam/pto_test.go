@@ -0,0 +1,155 @@
+package ioam_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/Advanced-Observability/ioam-exporter/internal/ioamtest"
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/mdlayher/netlink"
+)
+
+func TestExtractPtoDataOptionalBits(t *testing.T) {
+	// Bits 0, 4, 7, 11, 14 (undefined) and 6: 6 fields of 4 bytes per node
+	traceType := uint32(ioam.TRACE_TYPE_BIT0_MASK | ioam.TRACE_TYPE_BIT4_MASK | ioam.TRACE_TYPE_BIT6_MASK |
+		ioam.TRACE_TYPE_BIT7_MASK | ioam.TRACE_TYPE_BIT11_MASK | ioam.TRACE_TYPE_BIT14_MASK)
+	const nodeLen = 6
+
+	// Most recent node first
+	var data []byte
+	for hop := range uint32(2) {
+		data = binary.BigEndian.AppendUint32(data, 64<<24|(10+hop)) // hop limit and node ID
+		data = binary.BigEndian.AppendUint32(data, 100+hop)         // transit delay
+		data = binary.BigEndian.AppendUint32(data, 200+hop)         // queue depth
+		data = binary.BigEndian.AppendUint32(data, 300+hop)         // checksum complement
+		data = binary.BigEndian.AppendUint32(data, 400+hop)         // buffer occupancy
+		data = binary.BigEndian.AppendUint32(data, 0xFFFFFFFF)      // bit 14
+	}
+
+	trace, err := ioam.ExtractPtoData(ptoAttributes(1, nodeLen, traceType, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trace.TraceType != traceType || len(trace.Hops) != 2 {
+		t.Fatalf("got trace type %#06x and %d hops, want %#06x and 2", trace.TraceType, len(trace.Hops), traceType)
+	}
+	// Path order: the encapsulating node, last in the data, first
+	for i, node := range trace.Hops {
+		hop := uint32(len(trace.Hops) - 1 - i)
+		if node.NodeId != 10+hop || node.TransitDelay != 100+hop || node.QueueDepth != 200+hop ||
+			node.ChecksumComplement != 300+hop || node.BufferOccupancy != 400+hop {
+			t.Errorf("node %d: %+v", i, node)
+		}
+	}
+}
+
+func TestExtractPtoDataIncremental(t *testing.T) {
+	header := ioam.TraceHeader{NodeLen: uint8(ioam.PtoNodeLen(0xF00000)), Flags: ioam.IOAM6_TRACE_FLAG_OVERFLOW, RemainingLen: 3}
+	want := ioamtest.Trace(0xF00000, ioam.IOAM6_OPTION_TYPE_INCREMENTAL, header, ioamtest.Node(0xF00000, 1), ioamtest.Node(0xF00000, 2))
+	attrs := append(ptoAttributes(123, header.NodeLen, 0xF00000, ioamtest.TraceData(want)),
+		netlink.Attribute{Type: ioam.IOAM6_EVENT_ATTR_OPTION_TYPE, Data: []byte{ioam.IOAM6_OPTION_TYPE_INCREMENTAL}},
+		netlink.Attribute{Type: ioam.IOAM6_EVENT_ATTR_TRACE_FLAGS, Data: []byte{header.Flags}},
+		netlink.Attribute{Type: ioam.IOAM6_EVENT_ATTR_TRACE_REMLEN, Data: []byte{header.RemainingLen}})
+
+	trace, err := ioam.ExtractPtoData(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ioamtest.EqualTraces(trace, want) {
+		t.Errorf("got  %+v\nwant %+v", trace, want)
+	}
+}
+
+// Netlink attributes of a PTO event, as sent by the kernel
+func ptoAttributes(namespace uint16, nodeLen uint8, traceType uint32, data []byte) []netlink.Attribute {
+	return []netlink.Attribute{
+		{Type: ioam.IOAM6_EVENT_ATTR_TRACE_NAMESPACE, Data: binary.LittleEndian.AppendUint16(nil, namespace)},
+		{Type: ioam.IOAM6_EVENT_ATTR_TRACE_NODELEN, Data: []byte{nodeLen}},
+		{Type: ioam.IOAM6_EVENT_ATTR_TRACE_TYPE, Data: binary.LittleEndian.AppendUint32(nil, traceType<<8)},
+		{Type: ioam.IOAM6_EVENT_ATTR_TRACE_DATA, Data: data},
+	}
+}
+
+func TestExtractPtoDataMalformed(t *testing.T) {
+	traceType := uint32(ioam.TRACE_TYPE_BIT0_MASK | ioam.TRACE_TYPE_BIT8_MASK) // 1 + 2 units per node
+	node := make([]byte, 12)
+	snapshot := append(append([]byte{}, node...), 2, 0, 0, 1, 0xAA, 0xAA) // OSS header claims 8 bytes
+
+	tests := []struct {
+		name  string
+		attrs []netlink.Attribute
+		want  error
+	}{
+		{"bad node length", ptoAttributes(1, 2, traceType, node), ioam.ErrBadNodeLen},
+		{"zero node length", ptoAttributes(1, 0, traceType, nil), ioam.ErrBadNodeLen},
+		{"no field", ptoAttributes(1, 0, 0, node), ioam.ErrBadNodeLen},
+		{"truncated node", ptoAttributes(1, 3, traceType, node[:8]), ioam.ErrTruncatedNode},
+		{"partial second node", ptoAttributes(1, 3, traceType, append(node, 0, 0)), ioam.ErrTruncatedNode},
+		{"missing OSS header", ptoAttributes(1, 3, traceType|ioam.TRACE_TYPE_BIT22_MASK, node), ioam.ErrTruncatedSnapshot},
+		{"truncated snapshot", ptoAttributes(1, 3, traceType|ioam.TRACE_TYPE_BIT22_MASK, snapshot), ioam.ErrTruncatedSnapshot},
+		{"trace too long", ptoAttributes(1, 3, traceType, make([]byte, 12*21)), ioam.ErrTraceTooLong},
+		{"DEX option type", append(ptoAttributes(1, 3, traceType, node),
+			netlink.Attribute{Type: ioam.IOAM6_EVENT_ATTR_OPTION_TYPE, Data: []byte{ioam.IOAM6_OPTION_TYPE_DEX}}), ioam.ErrUnknownOptionType},
+		{"short namespace", []netlink.Attribute{{Type: ioam.IOAM6_EVENT_ATTR_TRACE_NAMESPACE, Data: []byte{1}}}, ioam.ErrTruncatedAttribute},
+	}
+	for _, tt := range tests {
+		if _, err := ioam.ExtractPtoData(tt.attrs); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestExtractPtoDataAllTraceTypes(t *testing.T) {
+	for combo := range uint32(1 << 12) {
+		for _, extra := range []uint32{0, ioam.TRACE_TYPE_BIT22_MASK, ioam.TRACE_TYPE_BIT14_MASK | ioam.TRACE_TYPE_BIT22_MASK} {
+			traceType := combo<<12 | extra
+			if traceType == 0 {
+				continue // no data
+			}
+			want := ioamtest.Trace(traceType, ioam.IOAM6_OPTION_TYPE_PREALLOC, ioam.TraceHeader{NodeLen: uint8(ioam.PtoNodeLen(traceType))},
+				ioamtest.Node(traceType, 1), ioamtest.Node(traceType, 2))
+			if traceType&ioam.TRACE_TYPE_BIT22_MASK != 0 && combo%2 == 0 {
+				// Empty snapshot, the schema is not transmitted
+				want.Hops[1].OssSchema, want.Hops[1].Snapshot, want.Hops[1].OssLen = 0, nil, 0
+			}
+
+			data := ioamtest.TraceData(want)
+			trace, err := ioam.ExtractPtoData(ptoAttributes(want.Namespace, uint8(ioam.PtoNodeLen(traceType)), traceType, data))
+			if err != nil {
+				t.Fatalf("trace type %#06x: %v", traceType, err)
+			}
+			if !ioamtest.EqualTraces(trace, want) {
+				t.Fatalf("trace type %#06x:\ngot  %+v\nwant %+v", traceType, trace, want)
+			}
+		}
+	}
+}
+
+func FuzzExtractPtoData(f *testing.F) {
+	for _, traceType := range []uint32{0xF00000, 0xFFF000 | ioam.TRACE_TYPE_BIT22_MASK, ioam.TRACE_TYPE_BIT8_MASK | ioam.TRACE_TYPE_BIT13_MASK} {
+		node := ioamtest.Node(traceType, 1)
+		f.Add(uint16(1), uint8(ioam.PtoNodeLen(traceType)), traceType, ioamtest.NodeData(traceType, node))
+	}
+
+	f.Fuzz(func(t *testing.T, namespace uint16, nodeLen uint8, traceType uint32, data []byte) {
+		trace, err := ioam.ExtractPtoData(ptoAttributes(namespace, nodeLen, traceType, data))
+		if err != nil {
+			return
+		}
+		// A successfully decoded trace re-encodes to the same data, unless
+		// it holds fields which are not kept: undefined fields, empty
+		// snapshots and the second hop limit
+		lossy := uint32(ioam.TRACE_TYPE_UNDEFINED_MASK | ioam.TRACE_TYPE_BIT22_MASK)
+		if traceType&ioam.TRACE_TYPE_BIT0_MASK != 0 {
+			lossy |= ioam.TRACE_TYPE_BIT8_MASK
+		}
+		if traceType&lossy != 0 {
+			return
+		}
+		if encoded := ioamtest.TraceData(trace); !bytes.Equal(encoded, data) {
+			t.Errorf("decoded %+v from %x, re-encoded to %x", trace, data, encoded)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+// Package ioam decodes the IOAM data (RFC 9197, RFC 9326) of the IOAM6 generic
+// netlink events of the kernel, of the IOAM options of IPv6 packets and of DEX
+// export packets into IoamTrace values
+package ioam
+
+import (
+	"net/netip"
+	"time"
+)
+
+// IOAM data carried by one option of a packet: the hops of a pre-allocated
+// or incremental trace, the node exporting a DEX option, or the fields of a
+// POT or E2E option
+type IoamTrace struct {
+	OptionType uint8
+	Namespace  uint16
+	TraceType  uint32      // trace options and DEX
+	Header     TraceHeader // pre-allocated and incremental traces only
+	DexFlowID  uint32
+	DexSeqNum  uint32
+	TraceId    uint64 // assigned by the exporter
+
+	ReceivedAt    time.Time
+	Interface     string     // capture interface, empty for other sources
+	ExportingNode netip.Addr // sender of DEX data received over UDP, invalid otherwise
+
+	// Proof-of-Transit and Edge-to-Edge options, which carry no node data
+	PotType          uint8
+	PotRandom        uint64
+	PotCumulative    uint64
+	E2EType          uint16
+	E2ESeqNum        uint64 // 64-bit sequence number
+	E2ESeqNum32      uint32 // 32-bit sequence number
+	E2ETimestampSecs uint32
+	E2ETimestampFrac uint32
+
+	Hops []IoamNode // path order, the encapsulating node first
+
+	HasDexFlowID bool // DexFlowID is present in the DEX option
+	HasDexSeqNum bool // DexSeqNum is present in the DEX option
+}
+
+// Data of a node, for the trace type of its trace
+type IoamNode struct {
+	HopLimit                    uint8
+	NodeId                      uint32 // 24 bits used.
+	IngressId, EgressId         uint16
+	TimestampSecs               uint32
+	TimestampFrac               uint32
+	TransitDelay                uint32 // nanoseconds, most significant bit is the overflow flag
+	NamespaceData               uint32
+	QueueDepth                  uint32
+	ChecksumComplement          uint32
+	NodeIdWide                  uint64 // 56 bits used.
+	IngressIdWide, EgressIdWide uint32
+	NamespaceDataWide           uint64
+	BufferOccupancy             uint32
+	OssLen                      uint8  // unused
+	OssSchema                   uint32 // 24 bits used.
+	Snapshot                    []byte
+	HopIndex                    uint8 // position in the trace
+}
+
+// Header fields of a pre-allocated or incremental trace option (RFC 9197
+// section 4.4)
+type TraceHeader struct {
+	NodeLen      uint8 // 5 bits, in 4-octet units
+	Flags        uint8 // 4 bits, overflow first
+	RemainingLen uint8 // 7 bits, in 4-octet units
+}
+
+// Whether a transit node ran out of space to add its data
+func (h TraceHeader) Overflow() bool {
+	return h.Flags&IOAM6_TRACE_FLAG_OVERFLOW != 0
+}
+
+// Whether the trace carries no IOAM data, i.e. a trace option without node
+func (t IoamTrace) Empty() bool {
+	return len(t.Hops) == 0 && !t.OptionRecord()
+}
+
+// Whether the trace is an option without node data: a POT or E2E option, or a
+// DEX option read from a packet, whose nodes export their data themselves
+func (t IoamTrace) OptionRecord() bool {
+	switch t.OptionType {
+	case IOAM6_OPTION_TYPE_POT, IOAM6_OPTION_TYPE_E2E:
+		return true
+	case IOAM6_OPTION_TYPE_DEX:
+		return len(t.Hops) == 0
+	}
+	return false
+}
+
+// Whether the traces of an option type come with a trace header
+func HasTraceHeader(optionType uint8) bool {
+	return optionType == IOAM6_OPTION_TYPE_PREALLOC || optionType == IOAM6_OPTION_TYPE_INCREMENTAL
+}
@@ -0,0 +1,20 @@
+package ipfix
+
+const (
+	IPFIX_VERSION   = 10
+	ULIEGE_PEN_IANA = 10383
+	TEMPLATE_ID     = 293 // First template ID allocated, must be higher than 255 (arbitrary)
+	IPFIX_DOMAIN_ID = 1
+
+	IPFIX_HEADER_LEN      = 16
+	IPFIX_SET_HEADER_LEN  = 4
+	IPFIX_MAX_MESSAGE_LEN = 65535 // the message length is a 16-bit field
+	IPFIX_MIN_MTU         = 256   // room for a header, a template and a record
+	IPFIX_VARIABLE_LENGTH = 65535
+
+	// IANA information elements
+	IPFIX_IE_SUB_TEMPLATE_LIST             = 292
+	IPFIX_IE_OBSERVATION_TIME_MILLISECONDS = 323
+
+	IPFIX_STL_SEMANTIC_ORDERED = 0x04 // RFC 6313 section 4.5.4
+)
@@ -0,0 +1,389 @@
+package ipfix
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+)
+
+// Errors returned by the decoder
+var (
+	ErrMalformedIPFIX  = errors.New("malformed IPFIX message")
+	ErrUnknownTemplate = errors.New("data set for an unknown template")
+)
+
+// Field specifier of a template learnt by the decoder
+type ipfixFieldSpec struct {
+	id         uint16 // without the enterprise bit
+	length     uint16
+	enterprise uint32
+}
+
+// Templates are scoped to an observation domain (RFC 7011 section 8)
+type ipfixTemplateKey struct {
+	domain uint32
+	id     uint16
+}
+
+// Decoder of the IPFIX messages built by this exporter: it learns the
+// templates of a transport session and converts data records back to traces
+type Decoder struct {
+	templates map[ipfixTemplateKey][]ipfixFieldSpec
+}
+
+// Creates a decoder without any known template
+func NewDecoder() *Decoder {
+	return &Decoder{templates: make(map[ipfixTemplateKey][]ipfixFieldSpec)}
+}
+
+// Decodes an IPFIX message. Every data record becomes a trace: a single hop
+// for flat records, every hop of the subTemplateList for trace records, no hop
+// for POT and E2E records.
+func (d *Decoder) Decode(msg []byte) (IPFIXHeader, []ioam.IoamTrace, error) {
+	var header IPFIXHeader
+	if len(msg) < IPFIX_HEADER_LEN {
+		return header, nil, fmt.Errorf("%w: %d bytes", ErrMalformedIPFIX, len(msg))
+	}
+	header = IPFIXHeader{
+		Version:    binary.BigEndian.Uint16(msg[0:2]),
+		Length:     binary.BigEndian.Uint16(msg[2:4]),
+		ExportTime: binary.BigEndian.Uint32(msg[4:8]),
+		SeqNumber:  binary.BigEndian.Uint32(msg[8:12]),
+		DomainID:   binary.BigEndian.Uint32(msg[12:16]),
+	}
+	if header.Version != IPFIX_VERSION {
+		return header, nil, fmt.Errorf("%w: version %d", ErrMalformedIPFIX, header.Version)
+	}
+	if int(header.Length) != len(msg) {
+		return header, nil, fmt.Errorf("%w: length %d, got %d bytes", ErrMalformedIPFIX, header.Length, len(msg))
+	}
+
+	var traces []ioam.IoamTrace
+	for body := msg[IPFIX_HEADER_LEN:]; len(body) > 0; {
+		if len(body) < IPFIX_SET_HEADER_LEN {
+			return header, nil, fmt.Errorf("%w: truncated set header", ErrMalformedIPFIX)
+		}
+		setID := binary.BigEndian.Uint16(body[0:2])
+		setLen := int(binary.BigEndian.Uint16(body[2:4]))
+		if setLen < IPFIX_SET_HEADER_LEN || setLen > len(body) {
+			return header, nil, fmt.Errorf("%w: set length %d", ErrMalformedIPFIX, setLen)
+		}
+		set := body[IPFIX_SET_HEADER_LEN:setLen]
+		body = body[setLen:]
+
+		switch {
+		case setID == 2:
+			if err := d.learnTemplates(header.DomainID, set); err != nil {
+				return header, nil, err
+			}
+		case setID >= 256:
+			fields, ok := d.templates[ipfixTemplateKey{header.DomainID, setID}]
+			if !ok {
+				return header, nil, fmt.Errorf("%w: %d", ErrUnknownTemplate, setID)
+			}
+			records, err := d.decodeDataSet(header.DomainID, fields, set)
+			if err != nil {
+				return header, nil, err
+			}
+			traces = append(traces, records...)
+		}
+		// Options template sets are not used by this exporter and skipped
+	}
+
+	return header, traces, nil
+}
+
+// Learns the template records of a template set, forgetting withdrawn ones
+func (d *Decoder) learnTemplates(domain uint32, set []byte) error {
+	// Padding is shorter than a template record header
+	for len(set) >= 4 {
+		id := binary.BigEndian.Uint16(set[0:2])
+		count := int(binary.BigEndian.Uint16(set[2:4]))
+		set = set[4:]
+
+		if count == 0 {
+			if id == 2 {
+				for key := range d.templates {
+					if key.domain == domain {
+						delete(d.templates, key)
+					}
+				}
+			} else {
+				delete(d.templates, ipfixTemplateKey{domain, id})
+			}
+			continue
+		}
+		if id < 256 {
+			return fmt.Errorf("%w: template ID %d", ErrMalformedIPFIX, id)
+		}
+
+		fields := make([]ipfixFieldSpec, 0, count)
+		for range count {
+			if len(set) < 4 {
+				return fmt.Errorf("%w: truncated template %d", ErrMalformedIPFIX, id)
+			}
+			field := ipfixFieldSpec{
+				id:     binary.BigEndian.Uint16(set[0:2]) &^ 0x8000,
+				length: binary.BigEndian.Uint16(set[2:4]),
+			}
+			if binary.BigEndian.Uint16(set[0:2])&0x8000 != 0 {
+				if len(set) < 8 {
+					return fmt.Errorf("%w: truncated template %d", ErrMalformedIPFIX, id)
+				}
+				field.enterprise = binary.BigEndian.Uint32(set[4:8])
+				set = set[4:]
+			}
+			set = set[4:]
+			fields = append(fields, field)
+		}
+		d.templates[ipfixTemplateKey{domain, id}] = fields
+	}
+
+	return nil
+}
+
+// Decodes every record of a data set
+func (d *Decoder) decodeDataSet(domain uint32, fields []ipfixFieldSpec, set []byte) ([]ioam.IoamTrace, error) {
+	var traces []ioam.IoamTrace
+	// Padding is shorter than the smallest record, which holds at least one
+	// byte per fixed-length field or variable-length header
+	for len(set) >= len(fields) && len(set) > 0 {
+		var trace ioam.IoamTrace
+		node, rest, err := d.decodeRecord(domain, fields, set, &trace, true)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == len(set) {
+			return nil, fmt.Errorf("%w: empty data record", ErrMalformedIPFIX)
+		}
+		set = rest
+
+		// The hops of trace records come from their subTemplateList. Options
+		// without node data have none, DEX ones being told apart from hops by
+		// their trace type field.
+		switch {
+		case trace.Hops != nil:
+		case trace.OptionType == ioam.IOAM6_OPTION_TYPE_POT || trace.OptionType == ioam.IOAM6_OPTION_TYPE_E2E:
+		case trace.OptionType == ioam.IOAM6_OPTION_TYPE_DEX && hasField(fields, 17):
+		default:
+			trace.Hops = []ioam.IoamNode{node}
+		}
+		traces = append(traces, trace)
+	}
+
+	return traces, nil
+}
+
+// Whether a template holds the given enterprise-specific field
+func hasField(fields []ipfixFieldSpec, id uint16) bool {
+	for _, field := range fields {
+		if field.enterprise == ULIEGE_PEN_IANA && field.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Decodes a single record, setting the fields of the trace and returning the
+// fields of the hop and the remaining bytes. With lists, the hops of a
+// subTemplateList are decoded into the trace.
+func (d *Decoder) decodeRecord(domain uint32, fields []ipfixFieldSpec, data []byte, trace *ioam.IoamTrace, lists bool) (ioam.IoamNode, []byte, error) {
+	var node ioam.IoamNode
+	var traceType uint32
+	hasTraceType := false
+
+	for _, field := range fields {
+		value, rest, err := readFieldValue(data, field.length)
+		if err != nil {
+			return node, nil, err
+		}
+		data = rest
+
+		if field.enterprise == 0 {
+			// Nested lists are not used by this exporter
+			switch {
+			case field.id == IPFIX_IE_SUB_TEMPLATE_LIST && lists:
+				if err := d.decodeSubTemplateList(domain, value, trace); err != nil {
+					return node, nil, err
+				}
+			case field.id == IPFIX_IE_OBSERVATION_TIME_MILLISECONDS:
+				trace.ReceivedAt = time.UnixMilli(int64(decodeUnsigned(value)))
+			}
+			continue
+		}
+		if field.enterprise != ULIEGE_PEN_IANA {
+			continue
+		}
+
+		n := decodeUnsigned(value)
+		switch field.id {
+		case 0:
+			trace.Namespace = uint16(n)
+		case 1:
+			node.HopLimit = uint8(n)
+		case 2:
+			node.NodeId = uint32(n)
+			trace.TraceType |= ioam.TRACE_TYPE_BIT0_MASK
+		case 3:
+			node.IngressId = uint16(n)
+			trace.TraceType |= ioam.TRACE_TYPE_BIT1_MASK
+		case 4:
+			node.EgressId = uint16(n)
+		case 5:
+			node.TimestampSecs = uint32(n)
+			trace.TraceType |= ioam.TRACE_TYPE_BIT2_MASK
+		case 6:
+			node.TimestampFrac = uint32(n)
+			trace.TraceType |= ioam.TRACE_TYPE_BIT3_MASK
+		case 20:
+			node.TransitDelay = uint32(n)
+			trace.TraceType |= ioam.TRACE_TYPE_BIT4_MASK
+		case 7:
+			node.NamespaceData = uint32(n)
+			trace.TraceType |= ioam.TRACE_TYPE_BIT5_MASK
+		case 8:
+			node.QueueDepth = uint32(n)
+			trace.TraceType |= ioam.TRACE_TYPE_BIT6_MASK
+		case 21:
+			node.ChecksumComplement = uint32(n)
+			trace.TraceType |= ioam.TRACE_TYPE_BIT7_MASK
+		case 9:
+			node.NodeIdWide = n
+			trace.TraceType |= ioam.TRACE_TYPE_BIT8_MASK
+		case 10:
+			node.IngressIdWide = uint32(n)
+			trace.TraceType |= ioam.TRACE_TYPE_BIT9_MASK
+		case 11:
+			node.EgressIdWide = uint32(n)
+		case 12:
+			node.NamespaceDataWide = n
+			trace.TraceType |= ioam.TRACE_TYPE_BIT10_MASK
+		case 22:
+			node.BufferOccupancy = uint32(n)
+			trace.TraceType |= ioam.TRACE_TYPE_BIT11_MASK
+		case 13:
+			node.OssSchema = uint32(n)
+			trace.TraceType |= ioam.TRACE_TYPE_BIT22_MASK
+		case 14:
+			if len(value) > 0 {
+				node.Snapshot = value
+			}
+			node.OssLen = uint8(len(value) / 4)
+		case 15:
+			trace.DexFlowID = uint32(n)
+			trace.HasDexFlowID = true
+		case 16:
+			trace.DexSeqNum = uint32(n)
+			trace.HasDexSeqNum = true
+		case 23, 24:
+			if addr, ok := netip.AddrFromSlice(value); ok {
+				trace.ExportingNode = addr
+			}
+		case 17:
+			traceType = uint32(n)
+			hasTraceType = true
+		case 18:
+			trace.TraceId = n
+		case 19:
+			node.HopIndex = uint8(n)
+		case 25:
+			trace.OptionType = uint8(n)
+		case 33:
+			trace.Header.NodeLen = uint8(n)
+		case 34:
+			trace.Header.Flags = uint8(n)
+		case 35:
+			trace.Header.RemainingLen = uint8(n)
+		case 26:
+			trace.PotType = uint8(n)
+		case 27:
+			trace.PotRandom = n
+		case 28:
+			trace.PotCumulative = n
+		case 29:
+			trace.E2ESeqNum = n
+			trace.E2EType |= ioam.E2E_TYPE_BIT0_MASK
+		case 30:
+			trace.E2ESeqNum32 = uint32(n)
+			trace.E2EType |= ioam.E2E_TYPE_BIT1_MASK
+		case 31:
+			trace.E2ETimestampSecs = uint32(n)
+			trace.E2EType |= ioam.E2E_TYPE_BIT2_MASK
+		case 32:
+			trace.E2ETimestampFrac = uint32(n)
+			trace.E2EType |= ioam.E2E_TYPE_BIT3_MASK
+		}
+	}
+
+	// The trace type is only transmitted in trace records, it is otherwise
+	// derived from the fields of the record
+	if hasTraceType {
+		trace.TraceType = traceType
+	}
+
+	return node, data, nil
+}
+
+// Decodes the records of a subTemplateList (RFC 6313 section 4.5.2)
+func (d *Decoder) decodeSubTemplateList(domain uint32, list []byte, trace *ioam.IoamTrace) error {
+	if len(list) < 3 {
+		return fmt.Errorf("%w: truncated subTemplateList", ErrMalformedIPFIX)
+	}
+	id := binary.BigEndian.Uint16(list[1:3])
+	fields, ok := d.templates[ipfixTemplateKey{domain, id}]
+	if !ok {
+		return fmt.Errorf("%w: %d in subTemplateList", ErrUnknownTemplate, id)
+	}
+
+	trace.Hops = []ioam.IoamNode{}
+	for records := list[3:]; len(records) > 0; {
+		node, rest, err := d.decodeRecord(domain, fields, records, trace, false)
+		if err != nil {
+			return err
+		}
+		if len(rest) == len(records) {
+			return fmt.Errorf("%w: empty record in subTemplateList", ErrMalformedIPFIX)
+		}
+		records = rest
+		trace.Hops = append(trace.Hops, node)
+	}
+
+	return nil
+}
+
+// Reads a field value of the given length, decoding the length of
+// variable-length fields (RFC 7011 section 7)
+func readFieldValue(data []byte, length uint16) ([]byte, []byte, error) {
+	n := int(length)
+	if length == IPFIX_VARIABLE_LENGTH {
+		if len(data) < 1 {
+			return nil, nil, fmt.Errorf("%w: truncated variable-length field", ErrMalformedIPFIX)
+		}
+		n, data = int(data[0]), data[1:]
+		if n == 255 {
+			if len(data) < 2 {
+				return nil, nil, fmt.Errorf("%w: truncated variable-length field", ErrMalformedIPFIX)
+			}
+			n, data = int(binary.BigEndian.Uint16(data[0:2])), data[2:]
+		}
+	}
+	if len(data) < n {
+		return nil, nil, fmt.Errorf("%w: truncated field", ErrMalformedIPFIX)
+	}
+
+	return data[:n], data[n:], nil
+}
+
+// Decodes an unsigned integer of up to 8 bytes in network byte order,
+// including reduced-size encodings (RFC 7011 section 6.2)
+func decodeUnsigned(b []byte) uint64 {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
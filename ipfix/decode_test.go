@@ -0,0 +1,237 @@
+package ipfix
+
+import (
+	"bytes"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/internal/ioamtest"
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+)
+
+func TestIPFIXRoundTrip(t *testing.T) {
+	for combo := range uint32(1 << 12) {
+		for _, extra := range []uint32{0, ioam.TRACE_TYPE_BIT22_MASK, ioam.TRACE_TYPE_BIT17_MASK} {
+			traceType := combo<<12 | extra
+			header := ioam.TraceHeader{NodeLen: 7, Flags: uint8(combo % 16), RemainingLen: 100}
+			trace := ioamtest.Trace(traceType, uint8(combo%2), header, ioamtest.Node(traceType, 1), ioamtest.Node(traceType, 2), ioamtest.Node(traceType, 3))
+			trace.TraceId = 42
+			for i := range trace.Hops {
+				trace.Hops[i].HopIndex = uint8(i)
+			}
+			if combo%2 == 0 {
+				trace.DexSeqNum, trace.HasDexSeqNum = 9, true
+			}
+			switch combo % 3 {
+			case 1:
+				trace.ExportingNode = netip.MustParseAddr("192.0.2.1")
+			case 2:
+				trace.ExportingNode = netip.MustParseAddr("2001:db8::1")
+			}
+			checkRoundTrip(t, trace, false)
+			checkRoundTrip(t, trace, true)
+		}
+	}
+}
+
+func TestIPFIXRoundTripOptions(t *testing.T) {
+	// Options without node data are flat records in both encodings
+	pot := ioam.IoamTrace{Namespace: 7, OptionType: ioam.IOAM6_OPTION_TYPE_POT, PotRandom: 1 << 60, PotCumulative: 42, TraceId: 3}
+	checkRoundTrip(t, pot, false)
+
+	for ext := range 4 {
+		dex := ioam.IoamTrace{Namespace: 7, OptionType: ioam.IOAM6_OPTION_TYPE_DEX, TraceType: 0xF00000, TraceId: 5}
+		if ext&1 != 0 {
+			dex.DexFlowID, dex.HasDexFlowID = 1<<20, true
+		}
+		if ext&2 != 0 {
+			dex.DexSeqNum, dex.HasDexSeqNum = 9, true
+		}
+		checkRoundTrip(t, dex, false)
+	}
+
+	for e2eType := range uint16(16) {
+		e2e := ioam.IoamTrace{Namespace: 7, OptionType: ioam.IOAM6_OPTION_TYPE_E2E, E2EType: e2eType << 12, TraceId: 4}
+		if e2e.E2EType&ioam.E2E_TYPE_BIT0_MASK != 0 {
+			e2e.E2ESeqNum = 1 << 40
+		}
+		if e2e.E2EType&ioam.E2E_TYPE_BIT1_MASK != 0 {
+			e2e.E2ESeqNum32 = 1 << 20
+		}
+		if e2e.E2EType&ioam.E2E_TYPE_BIT2_MASK != 0 {
+			e2e.E2ETimestampSecs = 1700000000
+		}
+		if e2e.E2EType&ioam.E2E_TYPE_BIT3_MASK != 0 {
+			e2e.E2ETimestampFrac = 500
+		}
+		checkRoundTrip(t, e2e, false)
+	}
+}
+
+func TestIPFIXDecodeTraceHeader(t *testing.T) {
+	const hopTemplateID, traceTemplateID = 300, 301
+	// Without hops, the header can only come from the trace record
+	trace := ioam.IoamTrace{
+		Namespace: 5, TraceType: ioam.TRACE_TYPE_BIT2_MASK, OptionType: ioam.IOAM6_OPTION_TYPE_INCREMENTAL, TraceId: 8,
+		Header: ioam.TraceHeader{NodeLen: 1, Flags: ioam.IOAM6_TRACE_FLAG_OVERFLOW, RemainingLen: 12},
+	}
+	template, err := CreateIOAMTraceTemplateSet(traceTemplateID, hopTemplateID, TemplateKeyOf(trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record bytes.Buffer
+	EncodeIoamTrace(&record, trace, hopTemplateID, time.Now())
+	data, _ := CreateDataSet(traceTemplateID, record.Bytes())
+	msg, _ := WrapIPFIXSets(IPFIX_DOMAIN_ID, 0, template, data)
+
+	_, traces, err := NewDecoder().Decode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 1 || traces[0].Header != trace.Header {
+		t.Errorf("got %+v, want header %+v", traces, trace.Header)
+	}
+}
+
+func TestIPFIXDecodeErrors(t *testing.T) {
+	trace := ioam.IoamTrace{TraceType: ioam.TRACE_TYPE_BIT2_MASK, Namespace: 1, Hops: make([]ioam.IoamNode, 1)}
+	seqNum := uint32(0)
+	msg, err := CreateIPFIXMessage(IPFIX_DOMAIN_ID, trace, &seqNum)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDecoder()
+	if _, _, err := d.Decode(msg[:len(msg)-1]); !errors.Is(err, ErrMalformedIPFIX) {
+		t.Errorf("truncated message: got %v", err)
+	}
+
+	// Data set without its template
+	data, _ := CreateIOAMDataSet(TEMPLATE_ID, IoamRecords(trace))
+	msg, _ = WrapIPFIXSets(IPFIX_DOMAIN_ID, 0, data)
+	if _, _, err := d.Decode(msg); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("unknown template: got %v", err)
+	}
+
+	// Withdrawn template
+	template, _, _ := CreateIOAMTemplateSet(TEMPLATE_ID, TemplateKeyOf(trace))
+	withdrawal, _ := CreateTemplateWithdrawalSet(2)
+	msg, _ = WrapIPFIXSets(IPFIX_DOMAIN_ID, 0, template, withdrawal, data)
+	if _, _, err := d.Decode(msg); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("withdrawn template: got %v", err)
+	}
+}
+
+func FuzzIPFIXRoundTrip(f *testing.F) {
+	f.Add(uint32(0xFFF000|ioam.TRACE_TYPE_BIT22_MASK), uint64(1), []byte{1, 2, 3, 4}, uint8(3), uint8(3), false)
+	f.Add(uint32(ioam.TRACE_TYPE_BIT8_MASK|ioam.TRACE_TYPE_BIT13_MASK), uint64(0xFFFF), []byte(nil), uint8(1), uint8(0), true)
+
+	f.Fuzz(func(t *testing.T, traceType uint32, seed uint64, snapshot []byte, hops uint8, dex uint8, encodeTrace bool) {
+		// Bit 23 is reserved and the trace type is 24 bits long
+		traceType &= 0xFFFFFE
+
+		trace := ioamtest.Trace(traceType, ioam.IOAM6_OPTION_TYPE_PREALLOC, ioam.TraceHeader{}, make([]ioam.IoamNode, 1+hops%16)...)
+		for i := range trace.Hops {
+			node := ioamtest.Node(traceType, uint32(seed>>(4*i))%64)
+			if traceType&ioam.TRACE_TYPE_BIT0_MASK != 0 {
+				node.NodeId = uint32(seed) & 0xFFFFFF
+			}
+			if traceType&ioam.TRACE_TYPE_BIT8_MASK != 0 {
+				node.NodeIdWide = seed & 0xFFFFFFFFFFFFFF
+			}
+			if traceType&ioam.TRACE_TYPE_BIT22_MASK != 0 {
+				node.OssSchema = uint32(seed>>40) & 0xFFFFFF
+				node.Snapshot = snapshot[:min(len(snapshot), 255*4)&^3]
+				node.OssLen = uint8(len(node.Snapshot) / 4)
+			}
+			node.HopIndex = uint8(i)
+			trace.Hops[i] = node
+		}
+		trace.TraceId = seed
+		if dex&1 != 0 {
+			trace.DexFlowID, trace.HasDexFlowID = uint32(seed), true
+		}
+		if dex&2 != 0 {
+			trace.DexSeqNum, trace.HasDexSeqNum = uint32(seed>>32), true
+		}
+		checkRoundTrip(t, trace, encodeTrace)
+	})
+}
+
+func FuzzIPFIXDecode(f *testing.F) {
+	seqNum := uint32(0)
+	trace := ioamtest.Trace(0xFFF000|ioam.TRACE_TYPE_BIT22_MASK, ioam.IOAM6_OPTION_TYPE_PREALLOC, ioam.TraceHeader{}, ioamtest.Node(0xFFF000|ioam.TRACE_TYPE_BIT22_MASK, 1))
+	msg, _ := CreateIPFIXMessage(IPFIX_DOMAIN_ID, trace, &seqNum)
+	f.Add(msg)
+
+	f.Fuzz(func(t *testing.T, msg []byte) {
+		// Must not panic
+		NewDecoder().Decode(msg)
+	})
+}
+
+// Encodes a trace in a single IPFIX message, as one record per hop or as a
+// whole-trace record, decodes it and compares the result
+func checkRoundTrip(t *testing.T, trace ioam.IoamTrace, encodeTrace bool) {
+	t.Helper()
+
+	const hopTemplateID, traceTemplateID = 300, 301
+	observed := time.UnixMilli(1700000000123)
+	var template, data []byte
+	var err error
+	if encodeTrace {
+		template, err = CreateIOAMTraceTemplateSet(traceTemplateID, hopTemplateID, TemplateKeyOf(trace))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var record bytes.Buffer
+		EncodeIoamTrace(&record, trace, hopTemplateID, observed)
+		data, err = CreateDataSet(traceTemplateID, record.Bytes())
+	} else {
+		template, _, err = CreateIOAMTemplateSet(hopTemplateID, TemplateKeyOf(trace))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err = CreateIOAMDataSet(hopTemplateID, IoamRecords(trace))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := WrapIPFIXSets(IPFIX_DOMAIN_ID, 0, template, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, traces, err := NewDecoder().Decode(msg)
+	if err != nil {
+		t.Fatalf("trace type %#06x: %v", trace.TraceType, err)
+	}
+
+	// Trace records carry the observation time. Every flat record is a trace
+	// of its own, whose trace type is derived from its fields.
+	var want []ioam.IoamTrace
+	switch {
+	case encodeTrace:
+		trace.ReceivedAt = observed
+		want = []ioam.IoamTrace{trace}
+	case len(trace.Hops) == 0:
+		want = []ioam.IoamTrace{trace}
+	default:
+		for _, hop := range trace.Hops {
+			flat := trace
+			flat.TraceType &= ioamtest.DefinedFieldsMask | ioam.TRACE_TYPE_BIT22_MASK
+			flat.Hops = []ioam.IoamNode{hop}
+			want = append(want, flat)
+		}
+	}
+	if len(traces) != len(want) {
+		t.Fatalf("trace type %#06x (trace encoding %v): %d traces, want %d", trace.TraceType, encodeTrace, len(traces), len(want))
+	}
+	for i := range traces {
+		if !ioamtest.EqualTraces(traces[i], want[i]) {
+			t.Fatalf("trace type %#06x (trace encoding %v):\ngot  %+v\nwant %+v", trace.TraceType, encodeTrace, traces[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,662 @@
+// Package ipfix encodes IOAM traces in IPFIX messages (RFC 7011), with one
+// data record per hop or one per trace holding its hops in a subTemplateList
+// (RFC 6313), and decodes such messages back into traces
+package ipfix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+)
+
+// Error returned when the sets do not fit in a single IPFIX message
+var ErrMessageTooLong = errors.New("IPFIX message longer than 65535 bytes")
+
+// Creates a self-contained IPFIX message (template and data) of the given
+// observation domain containing the given trace, using TEMPLATE_ID. The
+// sequence number is owned by the caller and advanced by the number of data
+// records.
+func CreateIPFIXMessage(domainID uint32, trace ioam.IoamTrace, seqNum *uint32) ([]byte, error) {
+	// IPFIX Template Set
+	template, _, err := CreateIOAMTemplateSet(TEMPLATE_ID, TemplateKeyOf(trace))
+	if err != nil {
+		return nil, fmt.Errorf("template set: %w", err)
+	}
+
+	// IPFIX Data Set
+	records := IoamRecords(trace)
+	data, err := CreateIOAMDataSet(TEMPLATE_ID, records)
+	if err != nil {
+		return nil, err
+	}
+
+	packet, err := WrapIPFIXSets(domainID, *seqNum, template, data)
+	if err != nil {
+		return nil, err
+	}
+	*seqNum += uint32(len(records))
+
+	return packet, nil
+}
+
+// Wraps the given sets into an IPFIX message of the given observation domain
+func WrapIPFIXSets(domainID uint32, seqNum uint32, sets ...[]byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	// IPFIX Header
+	ipfixHeader := IPFIXHeader{
+		Version:    IPFIX_VERSION,
+		Length:     0, // Placeholder, will be updated later
+		ExportTime: uint32(time.Now().Unix()),
+		SeqNumber:  seqNum,
+		DomainID:   domainID,
+	}
+	if err := binary.Write(&buf, binary.BigEndian, ipfixHeader); err != nil {
+		return nil, err
+	}
+
+	for _, set := range sets {
+		buf.Write(set)
+	}
+
+	// Update total message length in the IPFIX header
+	packet := buf.Bytes()
+	if len(packet) > IPFIX_MAX_MESSAGE_LEN {
+		return nil, ErrMessageTooLong
+	}
+	binary.BigEndian.PutUint16(packet[2:4], uint16(len(packet)))
+
+	return packet, nil
+}
+
+// Creates an IPFIX data set holding the given encoded records
+func CreateIOAMDataSet(templateID uint16, records [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	// IPFIX Set Header
+	setHeader := IPFIXSetHeader{
+		SetId:     templateID,
+		SetLength: 0, // Placeholder, will be updated later
+	}
+	if err := binary.Write(&buf, binary.BigEndian, setHeader); err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		buf.Write(record)
+	}
+
+	// Update Set Length in the Data Set Header
+	packet := buf.Bytes()
+	if len(packet) > IPFIX_MAX_MESSAGE_LEN-IPFIX_HEADER_LEN {
+		return nil, ErrMessageTooLong
+	}
+	binary.BigEndian.PutUint16(packet[2:4], uint16(len(packet)))
+
+	return packet, nil
+}
+
+// Creates an IPFIX data set from already encoded records
+func CreateDataSet(templateID uint16, records []byte) ([]byte, error) {
+	if IPFIX_SET_HEADER_LEN+len(records) > IPFIX_MAX_MESSAGE_LEN-IPFIX_HEADER_LEN {
+		return nil, ErrMessageTooLong
+	}
+
+	set := make([]byte, IPFIX_SET_HEADER_LEN, IPFIX_SET_HEADER_LEN+len(records))
+	binary.BigEndian.PutUint16(set[0:2], templateID)
+	binary.BigEndian.PutUint16(set[2:4], uint16(IPFIX_SET_HEADER_LEN+len(records)))
+
+	return append(set, records...), nil
+}
+
+// Creates a template set withdrawing the given template (RFC 7011 section 8.1).
+// Withdrawing template ID 2 withdraws all the data templates.
+func CreateTemplateWithdrawalSet(templateID uint16) ([]byte, error) {
+	var buf bytes.Buffer
+
+	setHeader := IPFIXSetHeader{
+		SetId:     2, // 2 is the ID for a template set
+		SetLength: 8, // Set header and a withdrawal record
+	}
+	withdrawal := IPFIXTemplateRecord{
+		TemplateId: templateID,
+		FieldCount: 0, // No field means withdrawal
+	}
+
+	if err := binary.Write(&buf, binary.BigEndian, setHeader); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buf, binary.BigEndian, withdrawal.TemplateId); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(&buf, binary.BigEndian, withdrawal.FieldCount); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Creates an IPFIX template set for IOAM records of the given layout. The
+// hop records of whole-trace records only hold the data of their node, the
+// other fields being in the trace record.
+func CreateIOAMTemplateSet(templateID uint16, key TemplateKey) ([]byte, uint16, error) {
+	if key.OptionType != 0 {
+		return createIOAMOptionTemplateSet(templateID, key)
+	}
+
+	traceType := key.TraceType
+	var fieldCount uint16
+	var fields []IPFIXFieldSpecifier
+
+	// Add the Namespace field
+	if !key.Trace {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 0 | 0x8000, FieldLen: 2})
+		fieldCount++
+	}
+
+	// Add fields based on the trace type
+	if traceType&ioam.TRACE_TYPE_BIT0_MASK != 0 || traceType&ioam.TRACE_TYPE_BIT8_MASK != 0 {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 1 | 0x8000, FieldLen: 1})
+		fieldCount++
+	}
+
+	if traceType&ioam.TRACE_TYPE_BIT0_MASK != 0 {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 2 | 0x8000, FieldLen: 3})
+		fieldCount++
+	}
+
+	if traceType&ioam.TRACE_TYPE_BIT1_MASK != 0 {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 3 | 0x8000, FieldLen: 2})
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 4 | 0x8000, FieldLen: 2})
+		fieldCount += 2
+	}
+
+	if traceType&ioam.TRACE_TYPE_BIT2_MASK != 0 {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 5 | 0x8000, FieldLen: 4})
+		fieldCount++
+	}
+
+	if traceType&ioam.TRACE_TYPE_BIT3_MASK != 0 {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 6 | 0x8000, FieldLen: 4})
+		fieldCount++
+	}
+
+	if traceType&ioam.TRACE_TYPE_BIT4_MASK != 0 {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 20 | 0x8000, FieldLen: 4})
+		fieldCount++
+	}
+
+	if traceType&ioam.TRACE_TYPE_BIT5_MASK != 0 {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 7 | 0x8000, FieldLen: 4})
+		fieldCount++
+	}
+
+	if traceType&ioam.TRACE_TYPE_BIT6_MASK != 0 {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 8 | 0x8000, FieldLen: 4})
+		fieldCount++
+	}
+
+	if traceType&ioam.TRACE_TYPE_BIT7_MASK != 0 {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 21 | 0x8000, FieldLen: 4})
+		fieldCount++
+	}
+
+	if traceType&ioam.TRACE_TYPE_BIT8_MASK != 0 {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 9 | 0x8000, FieldLen: 7})
+		fieldCount++
+	}
+
+	if traceType&ioam.TRACE_TYPE_BIT9_MASK != 0 {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 10 | 0x8000, FieldLen: 4})
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 11 | 0x8000, FieldLen: 4})
+		fieldCount += 2
+	}
+
+	if traceType&ioam.TRACE_TYPE_BIT10_MASK != 0 {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 12 | 0x8000, FieldLen: 8})
+		fieldCount++
+	}
+
+	if traceType&ioam.TRACE_TYPE_BIT11_MASK != 0 {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 22 | 0x8000, FieldLen: 4})
+		fieldCount++
+	}
+
+	// Opaque State Snapshot (variable length)
+	if traceType&ioam.TRACE_TYPE_BIT22_MASK != 0 {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: (13 | 0x8000), FieldLen: 3})
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: (14 | 0x8000), FieldLen: 65535})
+		fieldCount += 2
+	}
+
+	if key.Trace {
+		// Position of the hop in its trace
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: (19 | 0x8000), FieldLen: 1})
+		fieldCount++
+	} else {
+		dex := traceFieldSpecifiers(key)
+		fields = append(fields, dex...)
+		fieldCount += uint16(len(dex))
+
+		// Trace correlation
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: (18 | 0x8000), FieldLen: 8})
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: (19 | 0x8000), FieldLen: 1})
+		fieldCount += 2
+
+		// IOAM option-type of the node data
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: (25 | 0x8000), FieldLen: 1})
+		fieldCount++
+
+		// Trace option header: node length, flags and RemainingLen
+		if key.TraceHeader {
+			header := traceHeaderSpecifiers()
+			fields = append(fields, header...)
+			fieldCount += uint16(len(header))
+		}
+	}
+
+	// Template Fields
+	template := IPFIXTemplateRecord{
+		TemplateId: templateID, // Unique Template ID for IOAM Data
+		FieldCount: fieldCount,
+		Fields:     fields,
+	}
+
+	packet, err := createTemplateSet(template)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return packet, fieldCount, nil
+}
+
+// Field specifiers of the DEX flow ID and sequence number and of the exporting
+// node, when the traces of the layout have them
+func traceFieldSpecifiers(key TemplateKey) []IPFIXFieldSpecifier {
+	var fields []IPFIXFieldSpecifier
+	if key.HasDexFlowID {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: (15 | 0x8000), FieldLen: 4})
+	}
+	if key.HasDexSeqNum {
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: (16 | 0x8000), FieldLen: 4})
+	}
+
+	// Exporting node of DEX data received over UDP
+	switch key.ExportingLen {
+	case 4:
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: (23 | 0x8000), FieldLen: 4})
+	case 16:
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: (24 | 0x8000), FieldLen: 16})
+	}
+	return fields
+}
+
+// Field specifiers of the trace option header: node length, flags and
+// RemainingLen
+func traceHeaderSpecifiers() []IPFIXFieldSpecifier {
+	return []IPFIXFieldSpecifier{
+		{FieldId: 33 | 0x8000, FieldLen: 1},
+		{FieldId: 34 | 0x8000, FieldLen: 1},
+		{FieldId: 35 | 0x8000, FieldLen: 1},
+	}
+}
+
+// Creates the IPFIX template set of the records of POT, E2E and DEX options,
+// which carry no node data
+func createIOAMOptionTemplateSet(templateID uint16, key TemplateKey) ([]byte, uint16, error) {
+	fields := []IPFIXFieldSpecifier{{FieldId: 0 | 0x8000, FieldLen: 2}} // Namespace
+
+	switch key.OptionType {
+	case ioam.IOAM6_OPTION_TYPE_POT:
+		fields = append(fields,
+			IPFIXFieldSpecifier{FieldId: 26 | 0x8000, FieldLen: 1}, // POT type
+			IPFIXFieldSpecifier{FieldId: 27 | 0x8000, FieldLen: 8}, // Random number
+			IPFIXFieldSpecifier{FieldId: 28 | 0x8000, FieldLen: 8}, // Cumulative value
+		)
+	case ioam.IOAM6_OPTION_TYPE_DEX:
+		fields = append(fields, IPFIXFieldSpecifier{FieldId: 17 | 0x8000, FieldLen: 4}) // Requested trace type
+		if key.HasDexFlowID {
+			fields = append(fields, IPFIXFieldSpecifier{FieldId: 15 | 0x8000, FieldLen: 4})
+		}
+		if key.HasDexSeqNum {
+			fields = append(fields, IPFIXFieldSpecifier{FieldId: 16 | 0x8000, FieldLen: 4})
+		}
+	default:
+		if key.E2EType&ioam.E2E_TYPE_BIT0_MASK != 0 {
+			fields = append(fields, IPFIXFieldSpecifier{FieldId: 29 | 0x8000, FieldLen: 8})
+		}
+		if key.E2EType&ioam.E2E_TYPE_BIT1_MASK != 0 {
+			fields = append(fields, IPFIXFieldSpecifier{FieldId: 30 | 0x8000, FieldLen: 4})
+		}
+		if key.E2EType&ioam.E2E_TYPE_BIT2_MASK != 0 {
+			fields = append(fields, IPFIXFieldSpecifier{FieldId: 31 | 0x8000, FieldLen: 4})
+		}
+		if key.E2EType&ioam.E2E_TYPE_BIT3_MASK != 0 {
+			fields = append(fields, IPFIXFieldSpecifier{FieldId: 32 | 0x8000, FieldLen: 4})
+		}
+	}
+
+	// Trace correlation and option type, as in node records
+	fields = append(fields,
+		IPFIXFieldSpecifier{FieldId: 18 | 0x8000, FieldLen: 8},
+		IPFIXFieldSpecifier{FieldId: 19 | 0x8000, FieldLen: 1},
+		IPFIXFieldSpecifier{FieldId: 25 | 0x8000, FieldLen: 1},
+	)
+
+	fieldCount := uint16(len(fields))
+	packet, err := createTemplateSet(IPFIXTemplateRecord{
+		TemplateId: templateID,
+		FieldCount: fieldCount,
+		Fields:     fields,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return packet, fieldCount, nil
+}
+
+// Creates an IPFIX template set for IOAM traces (RFC 6313): one record per
+// trace holding the trace-level fields and its hops in a subTemplateList. The
+// set also defines the template of the hops, which only hold node data.
+func CreateIOAMTraceTemplateSet(templateID uint16, hopTemplateID uint16, key TemplateKey) ([]byte, error) {
+	key.Trace = true
+	hops, _, err := CreateIOAMTemplateSet(hopTemplateID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []IPFIXFieldSpecifier{
+		{FieldId: 0 | 0x8000, FieldLen: 2},  // Namespace
+		{FieldId: 17 | 0x8000, FieldLen: 4}, // Trace type
+		{FieldId: 18 | 0x8000, FieldLen: 8}, // Trace ID
+		{FieldId: 25 | 0x8000, FieldLen: 1}, // Option type
+	}
+	if key.TraceHeader {
+		fields = append(fields, traceHeaderSpecifiers()...)
+	}
+	fields = append(fields, traceFieldSpecifiers(key)...)
+	fields = append(fields,
+		IPFIXFieldSpecifier{FieldId: IPFIX_IE_OBSERVATION_TIME_MILLISECONDS, FieldLen: 8},
+		IPFIXFieldSpecifier{FieldId: IPFIX_IE_SUB_TEMPLATE_LIST, FieldLen: IPFIX_VARIABLE_LENGTH},
+	)
+	trace, err := createTemplateSet(IPFIXTemplateRecord{
+		TemplateId: templateID,
+		FieldCount: uint16(len(fields)),
+		Fields:     fields,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Merge both template records into a single set, hops first
+	set := append(hops, trace[IPFIX_SET_HEADER_LEN:]...)
+	binary.BigEndian.PutUint16(set[2:4], uint16(len(set)))
+
+	return set, nil
+}
+
+// Creates an IPFIX template set holding the given template records
+func createTemplateSet(templates ...IPFIXTemplateRecord) ([]byte, error) {
+	var buf bytes.Buffer
+
+	// Template Set Header
+	templateSetHeader := IPFIXSetHeader{
+		SetId:     2, // 2 is the ID for a template set
+		SetLength: 0, // Placeholder, will be updated later
+	}
+	if err := binary.Write(&buf, binary.BigEndian, templateSetHeader); err != nil {
+		return nil, err
+	}
+
+	for _, template := range templates {
+		// Write Template ID and Field Count
+		if err := binary.Write(&buf, binary.BigEndian, template.TemplateId); err != nil {
+			return nil, err
+		}
+		if err := binary.Write(&buf, binary.BigEndian, template.FieldCount); err != nil {
+			return nil, err
+		}
+
+		// Write Field Specifiers to the buffer
+		for _, field := range template.Fields {
+			if err := binary.Write(&buf, binary.BigEndian, field); err != nil {
+				return nil, err
+			}
+			// Write enterprise ID of enterprise-specific fields
+			if field.FieldId&0x8000 != 0 {
+				if err := binary.Write(&buf, binary.BigEndian, uint32(ULIEGE_PEN_IANA)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// Update Set Length in the Template Set Header
+	packet := buf.Bytes()
+	binary.BigEndian.PutUint16(packet[2:4], uint16(len(packet)))
+
+	return packet, nil
+}
+
+// Encodes the data records of a trace, one per hop, or the single record of
+// an option without node data
+func IoamRecords(trace ioam.IoamTrace) [][]byte {
+	return hopRecords(trace, true)
+}
+
+// Encodes the hop records of a trace, flat or holding only node data, or the
+// single record of an option without node data
+func hopRecords(trace ioam.IoamTrace, flat bool) [][]byte {
+	if trace.OptionRecord() {
+		var record bytes.Buffer
+		encodeIoamOption(&record, trace)
+		return [][]byte{record.Bytes()}
+	}
+
+	records := make([][]byte, 0, len(trace.Hops))
+	for _, hop := range trace.Hops {
+		var record bytes.Buffer
+		encodeHop(&record, trace, hop, flat)
+		records = append(records, record.Bytes())
+	}
+	return records
+}
+
+// Encodes a whole trace into a single record, the hops being encoded as a
+// subTemplateList of records of the given hop template. The trace is observed
+// when it was received, or at observationTime if unknown.
+func EncodeIoamTrace(buf *bytes.Buffer, trace ioam.IoamTrace, hopTemplateID uint16, observationTime time.Time) {
+	if !trace.ReceivedAt.IsZero() {
+		observationTime = trace.ReceivedAt
+	}
+	binary.Write(buf, binary.BigEndian, trace.Namespace)
+	binary.Write(buf, binary.BigEndian, trace.TraceType)
+	binary.Write(buf, binary.BigEndian, trace.TraceId)
+	buf.WriteByte(trace.OptionType)
+	if ioam.HasTraceHeader(trace.OptionType) {
+		buf.WriteByte(trace.Header.NodeLen)
+		buf.WriteByte(trace.Header.Flags)
+		buf.WriteByte(trace.Header.RemainingLen)
+	}
+	encodeTraceFields(buf, trace)
+	binary.Write(buf, binary.BigEndian, uint64(observationTime.UnixMilli()))
+
+	var hops bytes.Buffer
+	for _, record := range hopRecords(trace, false) {
+		hops.Write(record)
+	}
+
+	// subTemplateList (variable length): semantic, template ID and records
+	writeVariableLength(buf, 3+hops.Len())
+	buf.WriteByte(IPFIX_STL_SEMANTIC_ORDERED)
+	binary.Write(buf, binary.BigEndian, hopTemplateID)
+	buf.Write(hops.Bytes())
+}
+
+// Encodes the flat record of a hop of a trace
+func EncodeIoam(buf *bytes.Buffer, t ioam.IoamTrace, d ioam.IoamNode) {
+	encodeHop(buf, t, d, true)
+}
+
+// Encodes the record of a hop: flat, with the fields of its trace, or only
+// its node data and hop index within a trace record
+func encodeHop(buf *bytes.Buffer, t ioam.IoamTrace, d ioam.IoamNode, flat bool) {
+	if flat {
+		binary.Write(buf, binary.BigEndian, t.Namespace)
+	}
+
+	if t.TraceType&ioam.TRACE_TYPE_BIT0_MASK != 0 || t.TraceType&ioam.TRACE_TYPE_BIT8_MASK != 0 {
+		buf.WriteByte(d.HopLimit)
+	}
+
+	if t.TraceType&ioam.TRACE_TYPE_BIT0_MASK != 0 {
+		writeUnsigned(buf, uint64(d.NodeId), 3)
+	}
+
+	if t.TraceType&ioam.TRACE_TYPE_BIT1_MASK != 0 {
+		binary.Write(buf, binary.BigEndian, d.IngressId)
+		binary.Write(buf, binary.BigEndian, d.EgressId)
+	}
+
+	if t.TraceType&ioam.TRACE_TYPE_BIT2_MASK != 0 {
+		binary.Write(buf, binary.BigEndian, d.TimestampSecs)
+	}
+
+	if t.TraceType&ioam.TRACE_TYPE_BIT3_MASK != 0 {
+		binary.Write(buf, binary.BigEndian, d.TimestampFrac)
+	}
+
+	if t.TraceType&ioam.TRACE_TYPE_BIT4_MASK != 0 {
+		binary.Write(buf, binary.BigEndian, d.TransitDelay)
+	}
+
+	if t.TraceType&ioam.TRACE_TYPE_BIT5_MASK != 0 {
+		binary.Write(buf, binary.BigEndian, d.NamespaceData)
+	}
+
+	if t.TraceType&ioam.TRACE_TYPE_BIT6_MASK != 0 {
+		binary.Write(buf, binary.BigEndian, d.QueueDepth)
+	}
+
+	if t.TraceType&ioam.TRACE_TYPE_BIT7_MASK != 0 {
+		binary.Write(buf, binary.BigEndian, d.ChecksumComplement)
+	}
+
+	if t.TraceType&ioam.TRACE_TYPE_BIT8_MASK != 0 {
+		writeUnsigned(buf, d.NodeIdWide, 7)
+	}
+
+	if t.TraceType&ioam.TRACE_TYPE_BIT9_MASK != 0 {
+		binary.Write(buf, binary.BigEndian, d.IngressIdWide)
+		binary.Write(buf, binary.BigEndian, d.EgressIdWide)
+	}
+
+	if t.TraceType&ioam.TRACE_TYPE_BIT10_MASK != 0 {
+		binary.Write(buf, binary.BigEndian, d.NamespaceDataWide)
+	}
+
+	if t.TraceType&ioam.TRACE_TYPE_BIT11_MASK != 0 {
+		binary.Write(buf, binary.BigEndian, d.BufferOccupancy)
+	}
+
+	if t.TraceType&ioam.TRACE_TYPE_BIT22_MASK != 0 {
+		writeUnsigned(buf, uint64(d.OssSchema), 3)
+
+		// Write Snapshot data
+		writeVariableLength(buf, len(d.Snapshot))
+		buf.Write(d.Snapshot)
+	}
+
+	if !flat {
+		buf.WriteByte(d.HopIndex)
+		return
+	}
+
+	encodeTraceFields(buf, t)
+	binary.Write(buf, binary.BigEndian, t.TraceId)
+	buf.WriteByte(d.HopIndex)
+	buf.WriteByte(t.OptionType)
+
+	if ioam.HasTraceHeader(t.OptionType) {
+		buf.WriteByte(t.Header.NodeLen)
+		buf.WriteByte(t.Header.Flags)
+		buf.WriteByte(t.Header.RemainingLen)
+	}
+}
+
+// Encodes the DEX flow ID and sequence number and the exporting node of a
+// trace, when it has them
+func encodeTraceFields(buf *bytes.Buffer, t ioam.IoamTrace) {
+	if t.HasDexFlowID {
+		binary.Write(buf, binary.BigEndian, t.DexFlowID)
+	}
+
+	if t.HasDexSeqNum {
+		binary.Write(buf, binary.BigEndian, t.DexSeqNum)
+	}
+
+	if t.ExportingNode.IsValid() {
+		buf.Write(t.ExportingNode.AsSlice())
+	}
+}
+
+// Encodes the record of a POT, E2E or DEX option without node data
+func encodeIoamOption(buf *bytes.Buffer, t ioam.IoamTrace) {
+	binary.Write(buf, binary.BigEndian, t.Namespace)
+
+	switch t.OptionType {
+	case ioam.IOAM6_OPTION_TYPE_POT:
+		buf.WriteByte(t.PotType)
+		binary.Write(buf, binary.BigEndian, t.PotRandom)
+		binary.Write(buf, binary.BigEndian, t.PotCumulative)
+	case ioam.IOAM6_OPTION_TYPE_DEX:
+		binary.Write(buf, binary.BigEndian, t.TraceType)
+		if t.HasDexFlowID {
+			binary.Write(buf, binary.BigEndian, t.DexFlowID)
+		}
+		if t.HasDexSeqNum {
+			binary.Write(buf, binary.BigEndian, t.DexSeqNum)
+		}
+	default:
+		if t.E2EType&ioam.E2E_TYPE_BIT0_MASK != 0 {
+			binary.Write(buf, binary.BigEndian, t.E2ESeqNum)
+		}
+		if t.E2EType&ioam.E2E_TYPE_BIT1_MASK != 0 {
+			binary.Write(buf, binary.BigEndian, t.E2ESeqNum32)
+		}
+		if t.E2EType&ioam.E2E_TYPE_BIT2_MASK != 0 {
+			binary.Write(buf, binary.BigEndian, t.E2ETimestampSecs)
+		}
+		if t.E2EType&ioam.E2E_TYPE_BIT3_MASK != 0 {
+			binary.Write(buf, binary.BigEndian, t.E2ETimestampFrac)
+		}
+	}
+
+	binary.Write(buf, binary.BigEndian, t.TraceId)
+	buf.WriteByte(0) // hop index
+	buf.WriteByte(t.OptionType)
+}
+
+// Writes the size least significant bytes of an unsigned integer in network
+// byte order, as a reduced-size encoding (RFC 7011 section 6.2)
+func writeUnsigned(buf *bytes.Buffer, value uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		buf.WriteByte(byte(value >> (8 * i)))
+	}
+}
+
+// Writes the length of a variable-length field: one byte below 255, three
+// bytes otherwise (RFC 7011 section 7)
+func writeVariableLength(buf *bytes.Buffer, length int) {
+	if length < 255 {
+		writeUnsigned(buf, uint64(length), 1)
+		return
+	}
+	buf.WriteByte(255)
+	writeUnsigned(buf, uint64(length), 2)
+}
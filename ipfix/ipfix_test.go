@@ -0,0 +1,242 @@
+package ipfix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+)
+
+func TestEncodeIoamTrace(t *testing.T) {
+	const hopTemplateID = 300
+	traceType := uint32(ioam.TRACE_TYPE_BIT0_MASK | ioam.TRACE_TYPE_BIT1_MASK)
+
+	header := ioam.TraceHeader{NodeLen: 3, Flags: ioam.IOAM6_TRACE_FLAG_OVERFLOW, RemainingLen: 9}
+	trace := ioam.IoamTrace{TraceType: traceType, Namespace: 123, TraceId: 77, OptionType: ioam.IOAM6_OPTION_TYPE_INCREMENTAL, Header: header}
+	for i := range 3 {
+		trace.Hops = append(trace.Hops, ioam.IoamNode{
+			HopLimit:  uint8(64 - i),
+			IngressId: uint16(i),
+			EgressId:  uint16(i + 1),
+			HopIndex:  uint8(i),
+		})
+	}
+	observed := time.UnixMilli(1700000000123)
+
+	var buf bytes.Buffer
+	EncodeIoamTrace(&buf, trace, hopTemplateID, observed)
+	record := buf.Bytes()
+
+	if got := binary.BigEndian.Uint16(record[0:2]); got != 123 {
+		t.Errorf("namespace %d, want 123", got)
+	}
+	if got := binary.BigEndian.Uint32(record[2:6]); got != traceType {
+		t.Errorf("trace type %#x, want %#x", got, traceType)
+	}
+	if got := binary.BigEndian.Uint64(record[6:14]); got != 77 {
+		t.Errorf("trace ID %d, want 77", got)
+	}
+	if record[14] != ioam.IOAM6_OPTION_TYPE_INCREMENTAL {
+		t.Errorf("option type %d, want %d", record[14], ioam.IOAM6_OPTION_TYPE_INCREMENTAL)
+	}
+	if got := (ioam.TraceHeader{NodeLen: record[15], Flags: record[16], RemainingLen: record[17]}); got != header {
+		t.Errorf("trace header %+v, want %+v", got, header)
+	}
+	if got := binary.BigEndian.Uint64(record[18:26]); got != uint64(observed.UnixMilli()) {
+		t.Errorf("observation time %d, want %d", got, observed.UnixMilli())
+	}
+
+	// Hop record: hop limit (1), node ID (3), ingress/egress (4) and hop index
+	// (1), the trace-level fields being in the trace record
+	const hopLen = 9
+	list := record[26:]
+	if got, want := int(list[0]), 3+len(trace.Hops)*hopLen; got != want {
+		t.Fatalf("subTemplateList length %d, want %d", got, want)
+	}
+	if list[1] != IPFIX_STL_SEMANTIC_ORDERED {
+		t.Errorf("semantic %#x, want ordered", list[1])
+	}
+	if got := binary.BigEndian.Uint16(list[2:4]); got != hopTemplateID {
+		t.Errorf("sub-template ID %d, want %d", got, hopTemplateID)
+	}
+	for i, node := range trace.Hops {
+		hop := list[4+i*hopLen : 4+(i+1)*hopLen]
+		if hop[0] != node.HopLimit || binary.BigEndian.Uint16(hop[4:6]) != node.IngressId || hop[8] != uint8(i) {
+			t.Errorf("hop %d: record %x does not match %+v", i, hop, node)
+		}
+	}
+
+	// The receive time of the trace takes precedence
+	trace.ReceivedAt = observed.Add(time.Second)
+	buf.Reset()
+	EncodeIoamTrace(&buf, trace, hopTemplateID, observed)
+	if got := binary.BigEndian.Uint64(buf.Bytes()[18:26]); got != uint64(trace.ReceivedAt.UnixMilli()) {
+		t.Errorf("observation time %d, want %d", got, trace.ReceivedAt.UnixMilli())
+	}
+}
+
+func TestCreateIOAMTraceTemplateSet(t *testing.T) {
+	set, err := CreateIOAMTraceTemplateSet(301, 300, TemplateKey{TraceType: ioam.TRACE_TYPE_BIT2_MASK})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := int(binary.BigEndian.Uint16(set[2:4])); got != len(set) {
+		t.Fatalf("set length %d, want %d", got, len(set))
+	}
+
+	// Hop template: timestamp and hop index (enterprise-specific fields)
+	if id, count := binary.BigEndian.Uint16(set[4:6]), binary.BigEndian.Uint16(set[6:8]); id != 300 || count != 2 {
+		t.Errorf("hop template %d with %d fields, want 300 with 2", id, count)
+	}
+	trace := set[8+2*8:]
+	if id, count := binary.BigEndian.Uint16(trace[0:2]), binary.BigEndian.Uint16(trace[2:4]); id != 301 || count != 6 {
+		t.Errorf("trace template %d with %d fields, want 301 with 6", id, count)
+	}
+
+	// Namespace, trace type, trace ID and option type, then the IANA fields
+	// without enterprise number
+	for i, want := range []uint16{0, 17, 18, 25} {
+		if id := binary.BigEndian.Uint16(trace[4+i*8:]) &^ 0x8000; id != want {
+			t.Errorf("field %d, want %d", id, want)
+		}
+	}
+	fields := trace[4+4*8:]
+	if id := binary.BigEndian.Uint16(fields[0:2]); id != IPFIX_IE_OBSERVATION_TIME_MILLISECONDS {
+		t.Errorf("field %d, want observationTimeMilliseconds", id)
+	}
+	if id, length := binary.BigEndian.Uint16(fields[4:6]), binary.BigEndian.Uint16(fields[6:8]); id != IPFIX_IE_SUB_TEMPLATE_LIST || length != IPFIX_VARIABLE_LENGTH {
+		t.Errorf("field %d of length %d, want variable-length subTemplateList", id, length)
+	}
+	if len(fields) != 8 {
+		t.Errorf("%d trailing bytes, want 8", len(fields))
+	}
+
+	// The option header, DEX fields and exporting node are in the trace
+	// record only
+	set, err = CreateIOAMTraceTemplateSet(301, 300, TemplateKey{TraceType: ioam.TRACE_TYPE_BIT2_MASK, TraceHeader: true, HasDexFlowID: true, HasDexSeqNum: true, ExportingLen: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := binary.BigEndian.Uint16(set[6:8]); count != 2 {
+		t.Errorf("hop template with %d fields, want 2", count)
+	}
+	trace = set[8+2*8:]
+	if count := binary.BigEndian.Uint16(trace[2:4]); count != 12 {
+		t.Fatalf("trace template with %d fields, want 12", count)
+	}
+	for i, want := range []IPFIXFieldSpecifier{{33, 1}, {34, 1}, {35, 1}, {15, 4}, {16, 4}, {23, 4}} {
+		field := trace[4+(4+i)*8:]
+		if id, length := binary.BigEndian.Uint16(field[0:2])&^0x8000, binary.BigEndian.Uint16(field[2:4]); id != want.FieldId || length != want.FieldLen {
+			t.Errorf("field %d of length %d, want %d of length %d", id, length, want.FieldId, want.FieldLen)
+		}
+	}
+}
+
+func TestCreateIOAMTemplateSetGolden(t *testing.T) {
+	set, fieldCount, err := CreateIOAMTemplateSet(TEMPLATE_ID, TemplateKey{TraceType: ioam.TRACE_TYPE_BIT0_MASK | ioam.TRACE_TYPE_BIT2_MASK, HasDexSeqNum: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "00020048" + "01250008" + // set header, template 293 with 8 fields
+		"80000002" + "0000288f" + // namespace
+		"80010001" + "0000288f" + // hop limit
+		"80020003" + "0000288f" + // node ID
+		"80050004" + "0000288f" + // timestamp seconds
+		"80100004" + "0000288f" + // DEX sequence number
+		"80120008" + "0000288f" + // trace ID
+		"80130001" + "0000288f" + // hop index
+		"80190001" + "0000288f" // option type
+	if got := hex.EncodeToString(set); got != want || fieldCount != 8 {
+		t.Errorf("template set with %d fields\ngot  %s\nwant %s", fieldCount, got, want)
+	}
+}
+
+func TestCreateIPFIXMessageGolden(t *testing.T) {
+	trace := ioam.IoamTrace{
+		TraceType: ioam.TRACE_TYPE_BIT1_MASK | ioam.TRACE_TYPE_BIT2_MASK,
+		Namespace: 1,
+		TraceId:   5,
+		Header:    ioam.TraceHeader{NodeLen: 3, Flags: ioam.IOAM6_TRACE_FLAG_OVERFLOW, RemainingLen: 1},
+		Hops:      []ioam.IoamNode{{IngressId: 2, EgressId: 3, TimestampSecs: 4}},
+	}
+	seqNum := uint32(7)
+	msg, err := CreateIPFIXMessage(IPFIX_DOMAIN_ID, trace, &seqNum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(msg[4:8], []byte{0, 0, 0, 0}) // export time
+
+	want := "000a0083" + "00000000" + "00000007" + "00000001" + // header
+		"00020058" + "0125000a" + // template set
+		"80000002" + "0000288f" + "80030002" + "0000288f" + "80040002" + "0000288f" +
+		"80050004" + "0000288f" + "80120008" + "0000288f" + "80130001" + "0000288f" +
+		"80190001" + "0000288f" + "80210001" + "0000288f" + "80220001" + "0000288f" + "80230001" + "0000288f" +
+		"0125001b" + // data set
+		"0001" + "0002" + "0003" + "00000004" + "0000000000000005" + "00" + "00" + "030801"
+	if got := hex.EncodeToString(msg); got != want {
+		t.Errorf("IPFIX message\ngot  %s\nwant %s", got, want)
+	}
+	if seqNum != 8 {
+		t.Errorf("sequence number %d, want 8", seqNum)
+	}
+}
+
+func TestEncodeIoamReducedSize(t *testing.T) {
+	trace := ioam.IoamTrace{TraceType: ioam.TRACE_TYPE_BIT0_MASK | ioam.TRACE_TYPE_BIT8_MASK | ioam.TRACE_TYPE_BIT22_MASK, Namespace: 1}
+	node := ioam.IoamNode{
+		HopLimit:   64,
+		NodeId:     0x000102,
+		NodeIdWide: 0x01020304050607,
+		OssSchema:  0x0A0B0C,
+		Snapshot:   make([]byte, 300),
+	}
+
+	var buf bytes.Buffer
+	EncodeIoam(&buf, trace, node)
+	record := buf.Bytes()
+
+	want := "0001" + "40" + // namespace, hop limit
+		"000102" + // node ID
+		"01020304050607" + // wide node ID
+		"0a0b0c" + // opaque state schema ID
+		"ff012c" // snapshot length, 3-byte form
+	if got := hex.EncodeToString(record[:len(want)/2]); got != want {
+		t.Errorf("record\ngot  %s\nwant %s", got, want)
+	}
+	if got, want := len(record), len(want)/2+300+8+1+1+3; got != want {
+		t.Errorf("record of %d bytes, want %d", got, want)
+	}
+}
+
+func TestDataSetLengthLimit(t *testing.T) {
+	if _, err := CreateDataSet(TEMPLATE_ID, make([]byte, IPFIX_MAX_MESSAGE_LEN)); !errors.Is(err, ErrMessageTooLong) {
+		t.Errorf("CreateDataSet() error = %v, want %v", err, ErrMessageTooLong)
+	}
+	if _, err := WrapIPFIXSets(IPFIX_DOMAIN_ID, 0, make([]byte, IPFIX_MAX_MESSAGE_LEN)); !errors.Is(err, ErrMessageTooLong) {
+		t.Errorf("WrapIPFIXSets() error = %v, want %v", err, ErrMessageTooLong)
+	}
+}
+
+func TestWriteVariableLength(t *testing.T) {
+	for _, tt := range []struct {
+		length int
+		want   string
+	}{
+		{0, "00"},
+		{254, "fe"},
+		{255, "ff00ff"},
+		{1020, "ff03fc"},
+		{65535, "ffffff"},
+	} {
+		var buf bytes.Buffer
+		writeVariableLength(&buf, tt.length)
+		if got := hex.EncodeToString(buf.Bytes()); got != tt.want {
+			t.Errorf("length %d: got %s, want %s", tt.length, got, tt.want)
+		}
+	}
+}
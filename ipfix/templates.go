@@ -0,0 +1,40 @@
+package ipfix
+
+import "github.com/Advanced-Observability/ioam-exporter/ioam"
+
+// Properties of IOAM traces deciding the layout of their data records
+type TemplateKey struct {
+	TraceType    uint32
+	HasDexFlowID bool
+	HasDexSeqNum bool
+	ExportingLen int    // length of the exporting node address, 0 without
+	TraceHeader  bool   // pre-allocated and incremental traces
+	OptionType   uint8  // options without node data, which have their own records, 0 otherwise
+	E2EType      uint16 // E2E options only
+	Trace        bool   // whole-trace records, hops in a subTemplateList
+}
+
+// Template layout of the flat records of the given trace
+func TemplateKeyOf(trace ioam.IoamTrace) TemplateKey {
+	if trace.OptionRecord() {
+		switch trace.OptionType {
+		case ioam.IOAM6_OPTION_TYPE_DEX:
+			return TemplateKey{
+				OptionType:   trace.OptionType,
+				TraceType:    trace.TraceType,
+				HasDexFlowID: trace.HasDexFlowID,
+				HasDexSeqNum: trace.HasDexSeqNum,
+			}
+		case ioam.IOAM6_OPTION_TYPE_E2E:
+			return TemplateKey{OptionType: trace.OptionType, E2EType: trace.E2EType}
+		}
+		return TemplateKey{OptionType: trace.OptionType}
+	}
+	return TemplateKey{
+		TraceType:    trace.TraceType,
+		HasDexFlowID: trace.HasDexFlowID,
+		HasDexSeqNum: trace.HasDexSeqNum,
+		ExportingLen: trace.ExportingNode.BitLen() / 8,
+		TraceHeader:  ioam.HasTraceHeader(trace.OptionType),
+	}
+}
@@ -0,0 +1,29 @@
+package ipfix
+
+// Header of an IPFIX message (RFC 7011 section 3.1)
+type IPFIXHeader struct {
+	Version    uint16
+	Length     uint16
+	ExportTime uint32
+	SeqNumber  uint32
+	DomainID   uint32
+}
+
+// Header of a set (RFC 7011 section 3.3.2)
+type IPFIXSetHeader struct {
+	SetId     uint16
+	SetLength uint16
+}
+
+// Field specifier of a template record, without enterprise number
+type IPFIXFieldSpecifier struct {
+	FieldId  uint16
+	FieldLen uint16
+}
+
+// Template record and its field specifiers
+type IPFIXTemplateRecord struct {
+	TemplateId uint16
+	FieldCount uint16
+	Fields     []IPFIXFieldSpecifier
+}
@@ -0,0 +1,143 @@
+// Package afpacket captures the IPv6 packets carrying IOAM options with an
+// AF_PACKET socket, for kernels that do not send IOAM6 events
+package afpacket
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// Largest IPv6 packet without jumbogram, also the snapshot length of the filter
+const AFPACKET_BUFFER_LEN = 65536
+
+// Classic BPF filter of the packet sockets, run on the network header:
+// accepts the IPv6 packets whose Hop-by-Hop or Destination Options header,
+// right after the IPv6 header, starts with an IOAM option, possibly after a
+// padding option as inserted by Linux for the 4n+2 alignment of the option
+var ioamPacketFilter = []bpf.Instruction{
+	// IPv6 with a Hop-by-Hop or Destination Options header
+	bpf.LoadAbsolute{Off: 0, Size: 1},
+	bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0xF0},
+	bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: 0x60, SkipTrue: 13},
+	bpf.LoadAbsolute{Off: 6, Size: 1},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: ioam.IPPROTO_HOPOPTS, SkipTrue: 1},
+	bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: ioam.IPPROTO_DSTOPTS, SkipTrue: 10},
+	// First option
+	bpf.LoadAbsolute{Off: ioam.IPV6_HEADER_LEN + 2, Size: 1},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: ioam.IPV6_OPT_IOAM, SkipTrue: 9},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: ioam.IPV6_OPT_PAD1, SkipTrue: 5},
+	bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: ioam.IPV6_OPT_PADN, SkipTrue: 6},
+	// Option following PadN
+	bpf.LoadAbsolute{Off: ioam.IPV6_HEADER_LEN + 3, Size: 1},
+	bpf.TAX{},
+	bpf.LoadIndirect{Off: ioam.IPV6_HEADER_LEN + 4, Size: 1},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: ioam.IPV6_OPT_IOAM, SkipTrue: 3, SkipFalse: 2},
+	// Option following Pad1
+	bpf.LoadAbsolute{Off: ioam.IPV6_HEADER_LEN + 3, Size: 1},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: ioam.IPV6_OPT_IOAM, SkipTrue: 1},
+	bpf.RetConstant{Val: 0},
+	bpf.RetConstant{Val: AFPACKET_BUFFER_LEN},
+}
+
+// AF_PACKET socket receiving the IOAM packets of an interface, or of every
+// interface. Packets are received without their link-layer header.
+type Socket struct {
+	name string
+	file *os.File
+	conn syscall.RawConn
+}
+
+// Opens a packet socket on the given interface, every interface if empty
+func Open(ifName string) (*Socket, error) {
+	ifIndex := 0
+	if ifName != "" {
+		iface, err := net.InterfaceByName(ifName)
+		if err != nil {
+			return nil, err
+		}
+		ifIndex = iface.Index
+	} else {
+		ifName = "any"
+	}
+
+	filter, err := bpf.Assemble(ioamPacketFilter)
+	if err != nil {
+		return nil, err
+	}
+	program := make([]unix.SockFilter, len(filter))
+	for i, ins := range filter {
+		program[i] = unix.SockFilter{Code: ins.Op, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+
+	// No protocol until bound, so that no packet gets in before the filter
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open packet socket: %w", err)
+	}
+	if err := unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER,
+		&unix.SockFprog{Len: uint16(len(program)), Filter: &program[0]}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to attach packet filter: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_IPV6), Ifindex: ifIndex}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to bind packet socket to %s: %w", ifName, err)
+	}
+
+	// Registered in the runtime poller, so that closing the file unblocks reads
+	file := os.NewFile(uintptr(fd), "afpacket:"+ifName)
+	conn, err := file.SyscallConn()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &Socket{name: ifName, file: file, conn: conn}, nil
+}
+
+// Receives the next packet in buf, skipping the packets sent by the host:
+// they are seen again when received by the next node
+func (s *Socket) Read(buf []byte) (int, error) {
+	for {
+		var n int
+		var from unix.Sockaddr
+		var err error
+		readErr := s.conn.Read(func(fd uintptr) bool {
+			n, from, err = unix.Recvfrom(int(fd), buf, 0)
+			return !errors.Is(err, unix.EAGAIN)
+		})
+		if readErr != nil {
+			return 0, readErr
+		}
+		if err != nil {
+			return 0, err
+		}
+		if ll, ok := from.(*unix.SockaddrLinklayer); ok && ll.Pkttype == unix.PACKET_OUTGOING {
+			continue
+		}
+		return n, nil
+	}
+}
+
+// Interface name of the socket, "any" for every interface
+func (s *Socket) Name() string {
+	return s.name
+}
+
+// Closes the socket, unblocking the pending reads
+func (s *Socket) Close() error {
+	return s.file.Close()
+}
+
+// Converts a protocol number to network byte order, as in link-layer addresses
+func htons(v uint16) uint16 {
+	return binary.BigEndian.Uint16(binary.NativeEndian.AppendUint16(nil, v))
+}
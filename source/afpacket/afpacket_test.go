@@ -0,0 +1,95 @@
+package afpacket
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/internal/ioamtest"
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+func TestIoamPacketFilter(t *testing.T) {
+	vm, err := bpf.NewVM(ioamPacketFilter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	option := ioamtest.TraceOption(0, ioamtest.Trace(0xF00000, ioam.IOAM6_OPTION_TYPE_PREALLOC, ioam.TraceHeader{}, ioamtest.Node(0xF00000, 1)))
+	withPadding := func(padding ...byte) []byte {
+		header := append([]byte{59, 0}, padding...)
+		header = append(header, ioam.IPV6_OPT_IOAM, uint8(len(option)))
+		header = append(header, option...)
+		for len(header)%8 != 0 {
+			header = append(header, ioam.IPV6_OPT_PAD1)
+		}
+		header[1] = uint8(len(header)/8 - 1)
+		return ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, header)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		packet []byte
+		accept bool
+	}{
+		{"IOAM first", ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(59, option)), true},
+		{"after PadN", withPadding(ioam.IPV6_OPT_PADN, 0), true},
+		{"after longer PadN", withPadding(ioam.IPV6_OPT_PADN, 2, 0, 0), true},
+		{"after Pad1", withPadding(ioam.IPV6_OPT_PAD1), true},
+		{"Destination Options", ioamtest.IPv6Packet(ioam.IPPROTO_DSTOPTS, ioamtest.OptionsHeader(59, option)), true},
+		{"router alert", ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, []byte{59, 0, 5, 2, 0, 0, 1, 0}), false},
+		{"no options header", ioamtest.IPv6Packet(17, make([]byte, 8)), false},
+		{"IPv4", append([]byte{0x45, 0, 0, 20, 0, 0, 0, 0}, make([]byte, 60)...), false},
+		{"truncated", ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, nil), false},
+	} {
+		n, err := vm.Run(tt.packet)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if (n > 0) != tt.accept {
+			t.Errorf("%s: filter returned %d, accept %v", tt.name, n, tt.accept)
+		}
+	}
+}
+
+// Sends IOAM packets on the loopback interface and reads them back. Needs
+// CAP_NET_RAW.
+func TestPacketSocketLoopback(t *testing.T) {
+	s, err := Open("lo")
+	if errors.Is(err, unix.EPERM) {
+		t.Skip("packet sockets need CAP_NET_RAW")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(fd)
+	to := &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_IPV6), Ifindex: 1, Halen: 6}
+
+	want := ioamtest.Trace(0xF00000, ioam.IOAM6_OPTION_TYPE_PREALLOC, ioam.TraceHeader{NodeLen: 4}, ioamtest.Node(0xF00000, 1), ioamtest.Node(0xF00000, 2))
+	packet := ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(59, ioamtest.TraceOption(0, want)))
+	for _, p := range [][]byte{ioamtest.IPv6Packet(17, make([]byte, 8)), packet} {
+		if err := unix.Sendto(fd, p, 0, to); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the IOAM packet passes the filter
+	time.AfterFunc(5*time.Second, func() { s.Close() })
+	buf := make([]byte, AFPACKET_BUFFER_LEN)
+	n, err := s.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	traces, err := ioam.ExtractPacketTraces(ioam.LINKTYPE_RAW, buf[:n])
+	if err != nil || len(traces) != 1 || !ioamtest.EqualTraces(traces[0], want) {
+		t.Errorf("got %+v, %v", traces, err)
+	}
+}
@@ -0,0 +1,133 @@
+package netlink
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/genetlink"
+)
+
+// Error returned when reading a file that is not a valid capture
+var ErrBadCapture = errors.New("not an IOAM capture file")
+
+// Capture file of generic netlink messages. After CAPTURE_MAGIC, every
+// message is stored as:
+//
+//	length    uint32, bytes following the length
+//	timestamp int64, receive time in nanoseconds since the Unix epoch
+//	command   uint8
+//	version   uint8
+//	reserved  uint16, zero
+//	payload   attributes of the message
+//
+// Integers are in network byte order.
+type CaptureWriter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Opens a capture file for writing, appending to it if it already exists
+func CreateCapture(fileName string) (*CaptureWriter, error) {
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if info.Size() == 0 {
+		if _, err := file.WriteString(CAPTURE_MAGIC); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	return &CaptureWriter{file: file}, nil
+}
+
+// Appends a message received at the given time. The record is written to the
+// file at once, so that it survives the exporter being killed.
+func (c *CaptureWriter) Write(msg genetlink.Message, at time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	record := make([]byte, CAPTURE_RECORD_HEADER_LEN, CAPTURE_RECORD_HEADER_LEN+len(msg.Data))
+	binary.BigEndian.PutUint32(record[0:4], uint32(CAPTURE_RECORD_HEADER_LEN-4+len(msg.Data)))
+	binary.BigEndian.PutUint64(record[4:12], uint64(at.UnixNano()))
+	record[12] = msg.Header.Command
+	record[13] = msg.Header.Version
+	record = append(record, msg.Data...)
+
+	_, err := c.file.Write(record)
+	return err
+}
+
+// Closes the file
+func (c *CaptureWriter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.file.Close()
+}
+
+// Reader of the messages of a capture file
+type CaptureReader struct {
+	file *os.File
+	r    *bufio.Reader
+}
+
+// Opens a capture file for reading, checking its magic
+func OpenCapture(fileName string) (*CaptureReader, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &CaptureReader{file: file, r: bufio.NewReader(file)}
+	magic := make([]byte, len(CAPTURE_MAGIC))
+	if _, err := io.ReadFull(c.r, magic); err != nil || string(magic) != CAPTURE_MAGIC {
+		file.Close()
+		return nil, fmt.Errorf("%w: %s", ErrBadCapture, fileName)
+	}
+
+	return c, nil
+}
+
+// Reads the next message and its receive time, io.EOF at the end of the file
+func (c *CaptureReader) Next() (genetlink.Message, time.Time, error) {
+	var msg genetlink.Message
+	var header [CAPTURE_RECORD_HEADER_LEN]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = fmt.Errorf("%w: truncated record", ErrBadCapture)
+		}
+		return msg, time.Time{}, err
+	}
+
+	length := int(binary.BigEndian.Uint32(header[0:4]))
+	if length < len(header)-4 || length > CAPTURE_MAX_RECORD_LEN {
+		return msg, time.Time{}, fmt.Errorf("%w: record length %d", ErrBadCapture, length)
+	}
+	at := time.Unix(0, int64(binary.BigEndian.Uint64(header[4:12])))
+	msg.Header = genetlink.Header{Command: header[12], Version: header[13]}
+	msg.Data = make([]byte, length-(len(header)-4))
+	if _, err := io.ReadFull(c.r, msg.Data); err != nil {
+		return msg, time.Time{}, fmt.Errorf("%w: truncated record", ErrBadCapture)
+	}
+
+	return msg, at, nil
+}
+
+// Closes the file
+func (c *CaptureReader) Close() error {
+	return c.file.Close()
+}
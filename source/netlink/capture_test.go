@@ -0,0 +1,89 @@
+package netlink
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/generator"
+	"github.com/mdlayher/genetlink"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "events.cap")
+	g, err := generator.New(generator.Config{Kind: generator.KIND_MIXED, TraceType: 0xF00000, Hops: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type event struct {
+		msg genetlink.Message
+		at  time.Time
+	}
+	var want []event
+	// Written in two sessions, the second one appending
+	for range 2 {
+		c, err := CreateCapture(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range 3 {
+			e := event{msg: g.Next(), at: time.Unix(1700000000, int64(i))}
+			if err := c.Write(e.msg, e.at); err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, e)
+		}
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := OpenCapture(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for i, event := range want {
+		msg, at, err := r.Next()
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(msg, event.msg) || !at.Equal(event.at) {
+			t.Errorf("message %d: got %+v at %v, want %+v at %v", i, msg, at, event.msg, event.at)
+		}
+	}
+	if _, _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("end of file: got %v", err)
+	}
+}
+
+func TestCaptureWrittenBeforeClose(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "events.cap")
+	g, err := generator.New(generator.Config{Kind: generator.KIND_TRACE, TraceType: 0xF00000, Hops: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := CreateCapture(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	msg := g.Next()
+	if err := c.Write(msg, time.Unix(1700000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without Close, as when the exporter is killed
+	r, err := OpenCapture(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got, _, err := r.Next(); err != nil || !reflect.DeepEqual(got, msg) {
+		t.Errorf("got %+v, %v, want %+v", got, err, msg)
+	}
+}
@@ -0,0 +1,7 @@
+package netlink
+
+const (
+	CAPTURE_MAGIC             = "IOAMCAP\x01"
+	CAPTURE_RECORD_HEADER_LEN = 16 // length, timestamp and generic netlink header
+	CAPTURE_MAX_RECORD_LEN    = 1 << 20
+)
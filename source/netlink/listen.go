@@ -0,0 +1,62 @@
+// Package netlink receives the IOAM6 generic netlink events of the kernel and
+// records them in capture files to be replayed later
+package netlink
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+)
+
+// Error returned by Listen when the kernel does not send IOAM6 events
+var ErrNoIoamEvents = errors.New("no IOAM6 event support in the kernel")
+
+// Setup generic netlink listener on multicast group. Returns ErrNoIoamEvents
+// when the kernel lacks the IOAM6 family or its event group.
+func Listen() (*genetlink.Conn, error) {
+	// Genetlink connection
+	conn, err := genetlink.Dial(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create genetlink connection: %w", err)
+	}
+
+	// Set read buffer to 0 bytes to avoid data desynchronizations
+	conn.SetReadBuffer(0)
+	// Disable acknowledgements to save bandwidth
+	conn.SetOption(netlink.CapAcknowledge, false)
+
+	// Get genetlink IOAM6 family ID
+	family, err := conn.GetFamily(ioam.IOAM6_GENL_NAME)
+	if err != nil {
+		conn.Close()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: failed to get genetlink family: %v", ErrNoIoamEvents, err)
+		}
+		return nil, fmt.Errorf("failed to get genetlink family: %w", err)
+	}
+
+	var IOAM6_GENL_GROUP_ID uint32 = 0
+	for _, group := range family.Groups {
+		if group.Name == ioam.IOAM6_GENL_GROUP_NAME {
+			IOAM6_GENL_GROUP_ID = group.ID
+			break
+		}
+	}
+
+	if IOAM6_GENL_GROUP_ID == 0 {
+		conn.Close()
+		return nil, fmt.Errorf("%w: failed to get multicast group %s", ErrNoIoamEvents, ioam.IOAM6_GENL_GROUP_NAME)
+	}
+
+	// Subscribe to multicast group
+	if err := conn.JoinGroup(IOAM6_GENL_GROUP_ID); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to subscribe to multicast group: %w", err)
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,17 @@
+package pcap
+
+const (
+	PCAP_MAGIC_MICROSECONDS = 0xA1B2C3D4
+	PCAP_MAGIC_NANOSECONDS  = 0xA1B23C4D
+	PCAP_HEADER_LEN         = 24
+	PCAP_RECORD_HEADER_LEN  = 16
+	PCAP_MAX_PACKET_LEN     = 16 << 20 // also bounds pcapng blocks
+
+	PCAPNG_BLOCK_SECTION_HEADER  = 0x0A0D0D0A
+	PCAPNG_BLOCK_INTERFACE       = 1
+	PCAPNG_BLOCK_SIMPLE_PACKET   = 3
+	PCAPNG_BLOCK_ENHANCED_PACKET = 6
+	PCAPNG_BYTE_ORDER_MAGIC      = 0x1A2B3C4D
+	PCAPNG_OPTION_END            = 0
+	PCAPNG_OPTION_IF_TSRESOL     = 9
+)
@@ -0,0 +1,262 @@
+// Package pcap reads the packets of pcap and pcapng files
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"time"
+)
+
+// Error returned when reading a malformed pcap or pcapng file
+var ErrBadFile = errors.New("malformed pcap file")
+
+// Packet read from a pcap or pcapng file
+type Packet struct {
+	LinkType  uint16
+	Data      []byte
+	Timestamp time.Time
+}
+
+// Interface of a pcapng section
+type pcapngInterface struct {
+	linkType uint16
+	tsPerSec uint64 // timestamp units per second
+}
+
+// Reader of the packets of a pcap or pcapng file
+type File struct {
+	file  *os.File
+	r     *bufio.Reader
+	order binary.ByteOrder
+
+	// pcap
+	linkType uint16
+	nanos    bool
+
+	// pcapng, interfaces of the current section
+	ng         bool
+	interfaces []pcapngInterface
+}
+
+// Opens a pcap or pcapng file, recognised by its magic number
+func Open(fileName string) (*File, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{file: file, r: bufio.NewReader(file)}
+	if err := f.readFileHeader(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+
+	return f, nil
+}
+
+// Closes the file
+func (f *File) Close() error {
+	return f.file.Close()
+}
+
+// Reads the pcap global header, or checks that the file starts with a pcapng
+// section header block
+func (f *File) readFileHeader() error {
+	magic, err := f.r.Peek(4)
+	if err != nil {
+		return ErrBadFile
+	}
+
+	switch {
+	case binary.BigEndian.Uint32(magic) == PCAPNG_BLOCK_SECTION_HEADER:
+		// Read with the first block
+		f.ng = true
+		return nil
+	case binary.LittleEndian.Uint32(magic) == PCAP_MAGIC_MICROSECONDS, binary.LittleEndian.Uint32(magic) == PCAP_MAGIC_NANOSECONDS:
+		f.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(magic) == PCAP_MAGIC_MICROSECONDS, binary.BigEndian.Uint32(magic) == PCAP_MAGIC_NANOSECONDS:
+		f.order = binary.BigEndian
+	default:
+		return fmt.Errorf("%w: unknown magic %x", ErrBadFile, magic)
+	}
+
+	header := make([]byte, PCAP_HEADER_LEN)
+	if _, err := io.ReadFull(f.r, header); err != nil {
+		return fmt.Errorf("%w: truncated header", ErrBadFile)
+	}
+	f.nanos = f.order.Uint32(header[0:4]) == PCAP_MAGIC_NANOSECONDS
+	// The upper bits of the link type hold FCS information
+	f.linkType = uint16(f.order.Uint32(header[20:24]))
+
+	return nil
+}
+
+// Reads the next packet, io.EOF at the end of the file
+func (f *File) Next() (Packet, error) {
+	if f.ng {
+		return f.nextBlock()
+	}
+
+	header := make([]byte, PCAP_RECORD_HEADER_LEN)
+	if _, err := io.ReadFull(f.r, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = fmt.Errorf("%w: truncated record header", ErrBadFile)
+		}
+		return Packet{}, err
+	}
+	secs := int64(f.order.Uint32(header[0:4]))
+	frac := int64(f.order.Uint32(header[4:8]))
+	if !f.nanos {
+		frac *= 1000
+	}
+	length := f.order.Uint32(header[8:12])
+	if length > PCAP_MAX_PACKET_LEN {
+		return Packet{}, fmt.Errorf("%w: packet of %d bytes", ErrBadFile, length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(f.r, data); err != nil {
+		return Packet{}, fmt.Errorf("%w: truncated packet", ErrBadFile)
+	}
+
+	return Packet{LinkType: f.linkType, Data: data, Timestamp: time.Unix(secs, frac)}, nil
+}
+
+// Reads pcapng blocks until the next packet
+func (f *File) nextBlock() (Packet, error) {
+	for {
+		blockType, body, err := f.readBlock()
+		if err != nil {
+			return Packet{}, err
+		}
+
+		switch blockType {
+		case PCAPNG_BLOCK_SECTION_HEADER:
+			// Interfaces are numbered per section
+			f.interfaces = nil
+		case PCAPNG_BLOCK_INTERFACE:
+			if len(body) < 8 {
+				return Packet{}, fmt.Errorf("%w: truncated interface block", ErrBadFile)
+			}
+			f.interfaces = append(f.interfaces, f.readInterface(body))
+		case PCAPNG_BLOCK_ENHANCED_PACKET:
+			if len(body) < 20 {
+				return Packet{}, fmt.Errorf("%w: truncated packet block", ErrBadFile)
+			}
+			id := f.order.Uint32(body[0:4])
+			ts := uint64(f.order.Uint32(body[4:8]))<<32 | uint64(f.order.Uint32(body[8:12]))
+			length := f.order.Uint32(body[12:16])
+			if uint64(length) > uint64(len(body)-20) {
+				return Packet{}, fmt.Errorf("%w: packet of %d bytes", ErrBadFile, length)
+			}
+			return f.packet(id, ts, body[20:20+length])
+		case PCAPNG_BLOCK_SIMPLE_PACKET:
+			if len(body) < 4 {
+				return Packet{}, fmt.Errorf("%w: truncated packet block", ErrBadFile)
+			}
+			// The captured length is the minimum of the original length and
+			// the snapshot length, the padding is included in the block
+			length := min(uint64(f.order.Uint32(body[0:4])), uint64(len(body)-4))
+			return f.packet(0, 0, body[4:4+length])
+		}
+		// Other blocks (statistics, name resolution...) are skipped
+	}
+}
+
+// Reads a pcapng block and returns its type and its body. Section header
+// blocks also set the byte order of the section.
+func (f *File) readBlock() (uint32, []byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(f.r, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = fmt.Errorf("%w: truncated block header", ErrBadFile)
+		}
+		return 0, nil, err
+	}
+
+	if binary.BigEndian.Uint32(header[0:4]) == PCAPNG_BLOCK_SECTION_HEADER {
+		magic, err := f.r.Peek(4)
+		if err != nil {
+			return 0, nil, fmt.Errorf("%w: truncated section header", ErrBadFile)
+		}
+		switch {
+		case binary.LittleEndian.Uint32(magic) == PCAPNG_BYTE_ORDER_MAGIC:
+			f.order = binary.LittleEndian
+		case binary.BigEndian.Uint32(magic) == PCAPNG_BYTE_ORDER_MAGIC:
+			f.order = binary.BigEndian
+		default:
+			return 0, nil, fmt.Errorf("%w: unknown byte order magic %x", ErrBadFile, magic)
+		}
+	}
+	if f.order == nil {
+		return 0, nil, fmt.Errorf("%w: no section header", ErrBadFile)
+	}
+
+	blockType := f.order.Uint32(header[0:4])
+	length := f.order.Uint32(header[4:8])
+	if length < 12 || length%4 != 0 || length > PCAP_MAX_PACKET_LEN {
+		return 0, nil, fmt.Errorf("%w: block of %d bytes", ErrBadFile, length)
+	}
+
+	// Body and trailing length
+	body := make([]byte, length-8)
+	if _, err := io.ReadFull(f.r, body); err != nil {
+		return 0, nil, fmt.Errorf("%w: truncated block", ErrBadFile)
+	}
+
+	return blockType, body[:len(body)-4], nil
+}
+
+// Reads the link type and the timestamp resolution of an interface
+func (f *File) readInterface(body []byte) pcapngInterface {
+	intf := pcapngInterface{linkType: f.order.Uint16(body[0:2]), tsPerSec: 1000000}
+
+	// Options: code, length and value padded to 4 bytes
+	for options := body[8:]; len(options) >= 4; {
+		code := f.order.Uint16(options[0:2])
+		length := int(f.order.Uint16(options[2:4]))
+		if code == PCAPNG_OPTION_END || 4+length > len(options) {
+			break
+		}
+		if code == PCAPNG_OPTION_IF_TSRESOL && length == 1 {
+			// Negative power of 10, or of 2 with the most significant bit
+			resol := options[4]
+			base := uint64(10)
+			if resol&0x80 != 0 {
+				base, resol = 2, resol&0x7F
+			}
+			perSec := uint64(1)
+			for range resol {
+				if perSec > math.MaxUint64/base {
+					break
+				}
+				perSec *= base
+			}
+			intf.tsPerSec = perSec
+		}
+		options = options[min(len(options), 4+(length+3)&^3):]
+	}
+
+	return intf
+}
+
+// Builds a packet captured on the given interface of the section
+func (f *File) packet(id uint32, ts uint64, data []byte) (Packet, error) {
+	if int(id) >= len(f.interfaces) {
+		return Packet{}, fmt.Errorf("%w: unknown interface %d", ErrBadFile, id)
+	}
+	intf := f.interfaces[id]
+
+	// Fraction of second in nanoseconds, without overflow
+	hi, lo := bits.Mul64(ts%intf.tsPerSec, uint64(time.Second))
+	nanos, _ := bits.Div64(hi, lo, intf.tsPerSec)
+	timestamp := time.Unix(int64(ts/intf.tsPerSec), int64(nanos))
+
+	return Packet{LinkType: intf.linkType, Data: data, Timestamp: timestamp}, nil
+}
@@ -0,0 +1,61 @@
+package pcap_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Advanced-Observability/ioam-exporter/internal/ioamtest"
+	"github.com/Advanced-Observability/ioam-exporter/ioam"
+	"github.com/Advanced-Observability/ioam-exporter/source/pcap"
+)
+
+func TestPacketFileFormats(t *testing.T) {
+	const traceType = 0xF00000
+	trace := ioamtest.Trace(traceType, ioam.IOAM6_OPTION_TYPE_PREALLOC, ioam.TraceHeader{}, ioamtest.Node(traceType, 1), ioamtest.Node(traceType, 2))
+	packets := [][]byte{
+		ioamtest.EthernetFrame(ioamtest.IPv6Packet(ioam.IPPROTO_HOPOPTS, ioamtest.OptionsHeader(59, ioamtest.TraceOption(1, trace)))),
+		ioamtest.EthernetFrame(ioamtest.IPv6Packet(17, make([]byte, 8))),
+	}
+	timestamps := []time.Time{time.Unix(1700000000, 123456000), time.Unix(1700000001, 5000)}
+
+	for _, fileName := range []string{
+		ioamtest.WritePcap(t, ioam.LINKTYPE_ETHERNET, timestamps, packets),
+		ioamtest.WritePcapng(t, ioam.LINKTYPE_ETHERNET, timestamps, packets),
+	} {
+		f, err := pcap.Open(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range packets {
+			packet, err := f.Next()
+			if err != nil {
+				t.Fatalf("%s: packet %d: %v", fileName, i, err)
+			}
+			if packet.LinkType != ioam.LINKTYPE_ETHERNET || !packet.Timestamp.Equal(timestamps[i]) || string(packet.Data) != string(packets[i]) {
+				t.Errorf("%s: packet %d: link type %d at %v", fileName, i, packet.LinkType, packet.Timestamp)
+			}
+		}
+		f.Close()
+	}
+}
+
+func TestPacketFileMalformed(t *testing.T) {
+	for _, data := range [][]byte{
+		nil,
+		[]byte("not a capture"),
+		binary.LittleEndian.AppendUint32(nil, pcap.PCAP_MAGIC_NANOSECONDS),
+		// Section header block without byte order magic
+		{0x0A, 0x0D, 0x0D, 0x0A, 0, 0, 0, 12, 0, 0, 0, 0},
+	} {
+		f, err := pcap.Open(ioamtest.WriteTempFile(t, "bad.pcap", data))
+		if err == nil {
+			_, err = f.Next()
+			f.Close()
+		}
+		if !errors.Is(err, pcap.ErrBadFile) {
+			t.Errorf("%q: error %v, want %v", data, err, pcap.ErrBadFile)
+		}
+	}
+}